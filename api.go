@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rench1988/gslb-dns/log"
+	"github.com/rench1988/gslb-dns/zone"
+)
+
+// apiHandlers registers the platform management endpoints. Changes are
+// written back to the node file of the platform.
+func apiHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/platforms", apiAuth(apiListPlats))
+	mux.HandleFunc("GET /api/platforms/{plat}", apiAuth(apiGetPlat))
+	mux.HandleFunc("GET /api/platforms/{plat}/weights", apiAuth(apiGetWeights))
+	mux.HandleFunc("GET /api/platforms/{plat}/areas/{area}", apiAuth(apiGetArea))
+	mux.HandleFunc("PUT /api/platforms/{plat}/areas/{area}", apiAuth(apiPutArea))
+	mux.HandleFunc("DELETE /api/platforms/{plat}/areas/{area}", apiAuth(apiDeleteArea))
+	mux.HandleFunc("PUT /api/platforms/{plat}/areas/{area}/nodes/{ip}", apiAuth(apiPutNode))
+	mux.HandleFunc("DELETE /api/platforms/{plat}/areas/{area}/nodes/{ip}", apiAuth(apiDeleteNode))
+	mux.HandleFunc("PUT /api/platforms/{plat}/nodes/{ip}/state", apiAuth(apiPutNodeState))
+}
+
+// apiAuth requires the token from the "api" config section as a bearer
+// token. The API is disabled without one.
+func apiAuth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := getConf().API.Token
+		if len(token) == 0 {
+			apiError(w, http.StatusForbidden, "api is disabled")
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) != 1 {
+			apiError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+func apiListPlats(w http.ResponseWriter, r *http.Request) {
+	apiWrite(w, http.StatusOK, zone.CurrentPlats().PlatNames())
+}
+
+func apiGetPlat(w http.ResponseWriter, r *http.Request) {
+	areas, err := zone.CurrentPlats().GetAreas(r.PathValue("plat"))
+	if err != nil {
+		apiUpdateError(w, err)
+		return
+	}
+
+	apiWrite(w, http.StatusOK, areas)
+}
+
+// apiGetWeights returns the weights the nodes of a platform get right
+// now, with schedules, load feedback and slow start applied.
+func apiGetWeights(w http.ResponseWriter, r *http.Request) {
+	weights, err := zone.CurrentPlats().NodeWeights(r.PathValue("plat"))
+	if err != nil {
+		apiUpdateError(w, err)
+		return
+	}
+
+	apiWrite(w, http.StatusOK, weights)
+}
+
+func apiGetArea(w http.ResponseWriter, r *http.Request) {
+	areas, err := zone.CurrentPlats().GetAreas(r.PathValue("plat"))
+	if err != nil {
+		apiUpdateError(w, err)
+		return
+	}
+
+	area, ok := areas[r.PathValue("area")]
+	if !ok {
+		apiUpdateError(w, zone.ErrNoArea)
+		return
+	}
+
+	apiWrite(w, http.StatusOK, area)
+}
+
+func apiPutArea(w http.ResponseWriter, r *http.Request) {
+	area := new(zone.Area)
+	if err := json.NewDecoder(r.Body).Decode(area); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	plat, areaName := r.PathValue("plat"), r.PathValue("area")
+
+	if err := zone.SetArea(plat, areaName, area); err != nil {
+		apiUpdateError(w, err)
+		return
+	}
+
+	log.Printf("api: %s set area %s/%s", r.RemoteAddr, plat, areaName)
+	apiWrite(w, http.StatusOK, area)
+}
+
+func apiDeleteArea(w http.ResponseWriter, r *http.Request) {
+	plat, areaName := r.PathValue("plat"), r.PathValue("area")
+
+	if err := zone.DeleteArea(plat, areaName); err != nil {
+		apiUpdateError(w, err)
+		return
+	}
+
+	log.Printf("api: %s deleted area %s/%s", r.RemoteAddr, plat, areaName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiPutNode(w http.ResponseWriter, r *http.Request) {
+	n := new(zone.Node)
+	if err := json.NewDecoder(r.Body).Decode(n); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	n.Addr = r.PathValue("ip")
+
+	plat, areaName := r.PathValue("plat"), r.PathValue("area")
+
+	if err := zone.SetNode(plat, areaName, n); err != nil {
+		apiUpdateError(w, err)
+		return
+	}
+
+	log.Printf("api: %s set node %s in %s/%s", r.RemoteAddr, n.Addr, plat, areaName)
+	apiWrite(w, http.StatusOK, n)
+}
+
+func apiDeleteNode(w http.ResponseWriter, r *http.Request) {
+	plat, areaName, ip := r.PathValue("plat"), r.PathValue("area"), r.PathValue("ip")
+
+	if err := zone.DeleteNode(plat, areaName, ip); err != nil {
+		apiUpdateError(w, err)
+		return
+	}
+
+	log.Printf("api: %s deleted node %s in %s/%s", r.RemoteAddr, ip, plat, areaName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiPutNodeState puts a node in every area of a platform into "drain"
+// or "maintenance", or back to "active".
+func apiPutNodeState(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	plat, ip := r.PathValue("plat"), r.PathValue("ip")
+
+	if err := zone.SetNodeState(plat, ip, body.State); err != nil {
+		apiUpdateError(w, err)
+		return
+	}
+
+	log.Printf("api: %s set node %s in %s to %q", r.RemoteAddr, ip, plat, body.State)
+	apiWrite(w, http.StatusOK, body)
+}
+
+func apiUpdateError(w http.ResponseWriter, err error) {
+	switch {
+	case err == zone.ErrNoPlat, err == zone.ErrNoArea, err == zone.ErrNoNode:
+		apiError(w, http.StatusNotFound, err.Error())
+	case err == zone.ErrBadIP, err == zone.ErrBadState, err == zone.ErrBadCap,
+		errors.Is(err, zone.ErrBadHc), errors.Is(err, zone.ErrBadArea):
+		apiError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Println("api: update failed", err)
+		apiError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func apiError(w http.ResponseWriter, code int, msg string) {
+	apiWrite(w, code, map[string]string{"error": msg})
+}
+
+func apiWrite(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("api: error writing response", err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/rench1988/gslb-dns/log"
+	"github.com/rench1988/gslb-dns/targeting"
+	"github.com/rench1988/gslb-dns/zone"
+)
+
+type checkIssue struct {
+	File  string `json:"file"`
+	Path  string `json:"path,omitempty"`
+	Error string `json:"error"`
+}
+
+type checkReport struct {
+	OK     bool         `json:"ok"`
+	Errors []checkIssue `json:"errors"`
+}
+
+func (r *checkReport) add(file string, err error) {
+	if errs, ok := err.(zone.ParseErrors); ok {
+		for _, e := range errs {
+			r.Errors = append(r.Errors, checkIssue{File: file, Path: e.Path, Error: e.Msg})
+		}
+		return
+	}
+
+	r.Errors = append(r.Errors, checkIssue{File: file, Error: err.Error()})
+}
+
+// checkConfig loads every file of the configuration the way the server
+// would and cross checks them. It returns false when anything is wrong.
+func checkConfig(fileName string, format string) bool {
+	report := &checkReport{Errors: []checkIssue{}}
+
+	if err := readConf(fileName); err != nil {
+		report.add(fileName, err)
+		return writeReport(report, format)
+	}
+
+	cf := getConf()
+
+	zones := make(zone.Zones)
+	plats := make(zone.Plats)
+	targets := make(zone.Targets)
+
+	if len(cf.GeoIP.City) > 0 || len(cf.GeoIP.ASN) > 0 {
+		g, err := targeting.OpenGeoIP(cf.GeoIP.City, cf.GeoIP.ASN)
+		if err != nil {
+			report.add(cf.GeoIP.City+" "+cf.GeoIP.ASN, err)
+		} else {
+			g.Close()
+		}
+	}
+
+	platNames := make([]string, 0, len(cf.Platforms))
+	for k := range cf.Platforms {
+		platNames = append(platNames, k)
+	}
+	sort.Strings(platNames)
+
+	// the nodes of every platform first, labels can use any as a pool
+	for _, k := range platNames {
+		p := cf.Platforms[k]
+
+		if errs := p.PlatOptions.Check(fmt.Sprintf("platform[%q]", k)); len(errs) > 0 {
+			report.add(fileName, errs)
+		}
+
+		if err := plats.AddPlatInfo(k, p.Nodes); err != nil {
+			report.add(p.Nodes, err)
+		} else {
+			plats.SetPlatOptions(k, p.PlatOptions)
+			if errs := plats[k].Check(); len(errs) > 0 {
+				report.add(p.Nodes, errs)
+			}
+		}
+
+		if len(p.Areas) > 0 {
+			if err := targets.AddTargetInfo(k, p.Areas); err != nil {
+				report.add(p.Areas, err)
+			}
+		}
+	}
+
+	// the file each zone origin is served from
+	origins := make(map[string]string)
+
+	for _, k := range platNames {
+		files := cf.Platforms[k].zoneFiles(k)
+
+		fileNames := make([]string, 0, len(files))
+		for fn := range files {
+			fileNames = append(fileNames, fn)
+		}
+		sort.Strings(fileNames)
+
+		for _, fn := range fileNames {
+			z, err := zones.AddZoneInfo(k, files[fn], fn)
+			if err != nil {
+				report.add(fn, err)
+				continue
+			}
+
+			if other, ok := origins[z.Origin]; ok {
+				report.add(fn, fmt.Errorf("zone %s is already served from '%s'", z.Origin, other))
+				continue
+			}
+			origins[z.Origin] = fn
+
+			if errs := z.Check(plats); len(errs) > 0 {
+				report.add(fn, errs)
+			}
+		}
+	}
+
+	return writeReport(report, format)
+}
+
+func writeReport(report *checkReport, format string) bool {
+	report.OK = len(report.Errors) == 0
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(report); err != nil {
+			log.Println("Error writing report", err)
+		}
+		return report.OK
+	}
+
+	for _, e := range report.Errors {
+		if len(e.Path) > 0 {
+			log.Printf("%s: %s: %s", e.File, e.Path, e.Error)
+		} else {
+			log.Printf("%s: %s", e.File, e.Error)
+		}
+	}
+
+	if !report.OK {
+		log.Printf("%d errors in the configuration", len(report.Errors))
+	}
+
+	return report.OK
+}
@@ -2,12 +2,17 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/miekg/dns"
 	"github.com/rench1988/gslb-dns/log"
+	"github.com/rench1988/gslb-dns/metrics"
+	"github.com/rench1988/gslb-dns/targeting"
 	"github.com/rench1988/gslb-dns/util"
 
 	"github.com/rench1988/gslb-dns/zone"
@@ -25,9 +30,19 @@ type readRecord struct {
 	hash string
 }
 
+// zone files are tracked by file name, a platform can have many
 var lastZoneRead = map[string]*readRecord{}
+var zoneOrigins = map[string]string{}
+
+// files left out because their origin is served from another file
+var zoneDups = map[string]string{}
 var lastPlatRead = map[string]*readRecord{}
 
+// invalid platform options, logged once
+var badPlatOptions = map[string]zone.PlatOptions{}
+var lastAreaRead = map[string]*readRecord{}
+var lastGeoIPRead = map[string]*readRecord{}
+
 type queryLog struct {
 	Path    string `json:"path"`
 	MaxSize int    `json:"maxsize"`
@@ -35,12 +50,28 @@ type queryLog struct {
 }
 
 type platform struct {
-	Domains string `json:"domainFile"`
-	Nodes   string `json:"nodeFile"`
+	Domains   string `json:"domainFile"`
+	DomainDir string `json:"domainDir"`
+	Nodes     string `json:"nodeFile"`
+	Areas     string `json:"areaFile"`
+
+	zone.PlatOptions
+}
+
+type geoip struct {
+	City string `json:"cityFile"`
+	ASN  string `json:"asnFile"`
+}
+
+type apiConf struct {
+	Token string `json:"token"`
 }
 
 type gconf struct {
 	QLog      queryLog             `json:"queryLog"`
+	API       apiConf              `json:"api"`
+	GeoIP     geoip                `json:"geoip"`
+	LoadFeed  loadFeed             `json:"loadFeed"`
 	Platforms map[string]*platform `json:"platform"`
 }
 
@@ -121,54 +152,100 @@ func confWatcher(fileName string) {
 	}
 }
 
-func zonesReader(zs zone.Zones) {
+func zonesReader() {
 	for {
 		cf := getConf()
-		zonesReadConf(cf, zs)
+		zone.UpdateZones(func(zs zone.Zones) error {
+			zonesReadConf(cf, zs)
+			return nil
+		})
 		time.Sleep(5 * time.Second)
 	}
 }
 
+// zonesReadConf loads the domain files that changed into zs. The files
+// are read in order of their names and a file whose origin is already
+// served from another file is left out until that one goes away.
 func zonesReadConf(cf *gconf, zs zone.Zones) {
 
 	seenZones := map[string]bool{}
+	seenFiles := map[string]bool{}
+
+	type zoneFile struct {
+		plat, name, origin string
+		modTime            time.Time
+	}
+	var files []zoneFile
 
 	for k, plat := range cf.Platforms {
-		filename := plat.Domains
+		for filename, origin := range plat.zoneFiles(k) {
+			file, err := os.Stat(filename)
+			if err != nil {
+				continue
+			}
+			seenFiles[filename] = true
+			files = append(files, zoneFile{k, filename, origin, file.ModTime()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
 
-		file, err := os.Stat(filename)
-		if err != nil {
-			continue
+	for filename := range lastZoneRead {
+		if !seenFiles[filename] {
+			delete(lastZoneRead, filename)
+			delete(zoneOrigins, filename)
+			delete(zoneDups, filename)
 		}
+	}
 
-		if _, ok := lastZoneRead[k]; !ok || file.ModTime().After(lastZoneRead[k].time) {
-			modTime := file.ModTime()
+	// read the files left out again once their origin is free
+	for filename, origin := range zoneDups {
+		if len(originFile(origin, filename)) == 0 {
+			delete(lastZoneRead, filename)
+			delete(zoneDups, filename)
+		}
+	}
+
+	for _, f := range files {
+		k, filename, origin, modTime := f.plat, f.name, f.origin, f.modTime
+
+		if _, ok := lastZoneRead[filename]; !ok || modTime.After(lastZoneRead[filename].time) {
 
 			if ok {
 				log.Printf("Reloading %s\n", filename)
-				lastZoneRead[k].time = modTime
+				lastZoneRead[filename].time = modTime
 			} else {
 				log.Printf("Reading new file %s\n", filename)
-				lastZoneRead[k] = &readRecord{time: modTime}
+				lastZoneRead[filename] = &readRecord{time: modTime}
 			}
 
 			sha256 := util.Sha256File(filename)
-			if lastZoneRead[k].hash == sha256 {
-				continue
-			}
-
-			zone, err := zs.AddZoneInfo(k, filename)
-			if err != nil {
-				log.Printf("Error reading zone '%s': %s", k, err)
-				continue
+			if lastZoneRead[filename].hash != sha256 {
+				zone, err := zs.AddZoneInfo(k, origin, filename)
+				if err == nil {
+					if errs := zone.CheckLoops(); len(errs) > 0 {
+						err = errs
+					} else if other := originFile(zone.Origin, filename); len(other) > 0 {
+						err = fmt.Errorf("zone %s is already served from '%s'", zone.Origin, other)
+						zoneDups[filename] = zone.Origin
+					}
+				}
+				metrics.Reload("zone", err)
+				if err != nil {
+					log.Printf("Error reading zone file '%s', keeping the loaded zone", filename)
+					logZoneError(filename, err)
+				} else {
+					(lastZoneRead[filename]).hash = sha256
+					delete(zoneDups, filename)
+
+					zs[zone.Origin] = zone
+					zoneOrigins[filename] = zone.Origin
+				}
 			}
-
-			(lastZoneRead[k]).hash = sha256
-
-			zs.AddDNSHandler(k, zone)
 		}
 
-		seenZones[k] = true
+		if origin, ok := zoneOrigins[filename]; ok {
+			seenZones[origin] = true
+		}
 	}
 
 	for zoneName, zone := range zs {
@@ -179,33 +256,91 @@ func zonesReadConf(cf *gconf, zs zone.Zones) {
 			continue
 		}
 		log.Println("Removing zone", zone.Origin)
-		delete(lastZoneRead, zoneName)
-		dns.HandleRemove(zoneName)
 		delete(zs, zoneName)
 	}
 }
 
-func platsReader(ps zone.Plats) {
+// originFile returns the file other than filename the zone origin is
+// served from, if any.
+func originFile(origin string, filename string) string {
+	for fn, o := range zoneOrigins {
+		if o == origin && fn != filename {
+			return fn
+		}
+	}
+
+	return ""
+}
+
+// logZoneError logs each problem found in a domain file on its own line.
+func logZoneError(filename string, err error) {
+	if errs, ok := err.(zone.ParseErrors); ok {
+		for _, e := range errs {
+			log.Printf("%s: %s", filename, e)
+		}
+		return
+	}
+
+	log.Printf("%s: %s", filename, err)
+}
+
+// zoneFiles returns the domain files of the platform with the default
+// origin of each: the platform name for domainFile and the file name
+// without ".json" for the files in domainDir.
+func (p *platform) zoneFiles(platName string) map[string]string {
+	files := make(map[string]string)
+
+	if len(p.Domains) > 0 {
+		files[p.Domains] = platName
+	}
+
+	if len(p.DomainDir) > 0 {
+		matches, err := filepath.Glob(filepath.Join(p.DomainDir, "*.json"))
+		if err != nil {
+			log.Printf("Failed to read domain directory %s: %s\n", p.DomainDir, err)
+		}
+		for _, fn := range matches {
+			files[fn] = strings.TrimSuffix(filepath.Base(fn), ".json")
+		}
+	}
+
+	return files
+}
+
+func platsReader() {
 	for {
 		cf := getConf()
-		platsReadConf(cf, ps)
+
+		changed := false
+		zone.UpdatePlats(func(ps zone.Plats) error {
+			changed = platsReadConf(cf, ps)
+			return nil
+		})
+		zone.CurrentPlats().HealthCheck(changed)
+
 		time.Sleep(5 * time.Second)
 	}
 }
 
-func platsReadConf(cf *gconf, ps zone.Plats) {
+// platsReadConf loads the node files that changed into ps and reports
+// whether anything did.
+func platsReadConf(cf *gconf, ps zone.Plats) bool {
 	seenPlats := map[string]bool{}
 
 	changed := false
 
 	for k, plat := range cf.Platforms {
 		filename := plat.Nodes
+		loaded := false
 
 		file, err := os.Stat(filename)
 		if err != nil {
 			continue
 		}
 
+		// a node file that fails to load keeps the loaded nodes
+		seenPlats[k] = true
+
 		if _, ok := lastPlatRead[k]; !ok || file.ModTime().After(lastPlatRead[k].time) {
 			modTime := file.ModTime()
 
@@ -223,6 +358,7 @@ func platsReadConf(cf *gconf, ps zone.Plats) {
 			}
 
 			err = ps.AddPlatInfo(k, filename)
+			metrics.Reload("plat", err)
 			if err != nil {
 				log.Printf("Error reading platform '%s': %s", k, err)
 				continue
@@ -231,9 +367,24 @@ func platsReadConf(cf *gconf, ps zone.Plats) {
 			(lastPlatRead[k]).hash = sha256
 
 			changed = true
+			loaded = true
 		}
 
-		seenPlats[k] = true
+		if err := ps.SetPlatOptions(k, plat.PlatOptions); err != nil {
+			if bad, ok := badPlatOptions[k]; !ok || bad != plat.PlatOptions {
+				log.Printf("Invalid options for platform '%s', keeping the previous ones: %s", k, err)
+				badPlatOptions[k] = plat.PlatOptions
+			}
+		} else {
+			delete(badPlatOptions, k)
+		}
+
+		// problems that don't keep the nodes from loading
+		if loaded {
+			if errs := ps[k].Check(); len(errs) > 0 {
+				logZoneError(filename, errs)
+			}
+		}
 	}
 
 	for platName, _ := range ps {
@@ -242,10 +393,119 @@ func platsReadConf(cf *gconf, ps zone.Plats) {
 		}
 		log.Println("Removing plat", platName)
 		delete(lastPlatRead, platName)
+		delete(badPlatOptions, platName)
 		ps.DeletePlatInfo(platName)
 
 		changed = true
 	}
 
-	ps.HealthCheck(changed)
+	return changed
+}
+
+func targetsReader() {
+	for {
+		cf := getConf()
+		zone.UpdateTargets(func(ts zone.Targets) error {
+			targetsReadConf(cf, ts)
+			return nil
+		})
+		geoipReadConf(cf)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func targetsReadConf(cf *gconf, ts zone.Targets) {
+	seenPlats := map[string]bool{}
+
+	for k, plat := range cf.Platforms {
+		filename := plat.Areas
+		if len(filename) == 0 {
+			continue
+		}
+
+		file, err := os.Stat(filename)
+		if err != nil {
+			continue
+		}
+
+		seenPlats[k] = true
+
+		if _, ok := lastAreaRead[k]; !ok || file.ModTime().After(lastAreaRead[k].time) {
+			modTime := file.ModTime()
+
+			if ok {
+				log.Printf("Reloading %s\n", filename)
+				lastAreaRead[k].time = modTime
+			} else {
+				log.Printf("Reading new file %s\n", filename)
+				lastAreaRead[k] = &readRecord{time: modTime}
+			}
+
+			sha256 := util.Sha256File(filename)
+			if lastAreaRead[k].hash == sha256 {
+				continue
+			}
+
+			err = ts.AddTargetInfo(k, filename)
+			metrics.Reload("area", err)
+			if err != nil {
+				log.Printf("Error reading areas for '%s': %s", k, err)
+				continue
+			}
+
+			(lastAreaRead[k]).hash = sha256
+		}
+	}
+
+	for platName := range lastAreaRead {
+		if ok, _ := seenPlats[platName]; ok {
+			continue
+		}
+		log.Println("Removing areas of", platName)
+		delete(lastAreaRead, platName)
+		ts.DeleteTargetInfo(platName)
+	}
+}
+
+func geoipReadConf(cf *gconf) {
+	changed := false
+
+	files := []string{cf.GeoIP.City, cf.GeoIP.ASN}
+
+	for _, filename := range files {
+		if len(filename) == 0 {
+			continue
+		}
+
+		file, err := os.Stat(filename)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := lastGeoIPRead[filename]; !ok || file.ModTime().After(lastGeoIPRead[filename].time) {
+			lastGeoIPRead[filename] = &readRecord{time: file.ModTime()}
+			changed = true
+		}
+	}
+
+	for filename := range lastGeoIPRead {
+		if filename != cf.GeoIP.City && filename != cf.GeoIP.ASN {
+			delete(lastGeoIPRead, filename)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	log.Printf("Loading GeoIP databases: %s %s\n", cf.GeoIP.City, cf.GeoIP.ASN)
+
+	g, err := targeting.OpenGeoIP(cf.GeoIP.City, cf.GeoIP.ASN)
+	if err != nil {
+		log.Printf("Error loading GeoIP databases: %s", err)
+		return
+	}
+
+	zone.SetupGeoIP(g)
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rench1988/gslb-dns/zone"
+)
+
+func TestZonesDuplicateOrigin(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data string) string {
+		fn := filepath.Join(dir, name)
+		if err := os.WriteFile(fn, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return fn
+	}
+
+	a := write("dup.example.json", `{"data": {"": {"ns": ["ns1.example.com"]}, "a": {"a": ["1.1.1.1"]}}}`)
+	write("other.json", `{"origin": "dup.example", "data": {"": {"ns": ["ns1.example.com"]}, "b": {"a": ["2.2.2.2"]}}}`)
+
+	cf := &gconf{Platforms: map[string]*platform{"p": {DomainDir: dir}}}
+	zs := make(zone.Zones)
+
+	has := func(label string) bool {
+		z := zs["dup.example"]
+		return z != nil && z.Labels[label] != nil
+	}
+
+	// the first file by name serves the origin, every time
+	for i := 0; i < 2; i++ {
+		zonesReadConf(cf, zs)
+		if !has("a") || has("b") {
+			t.Fatalf("pass %d: dup.example not served from %s", i, a)
+		}
+	}
+
+	// the other file takes over once the first one is gone
+	if err := os.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	zonesReadConf(cf, zs)
+	if has("a") || !has("b") {
+		t.Error("dup.example not served from the remaining file")
+	}
+
+	if len(zoneDups) != 0 {
+		t.Errorf("left out files %v after the duplicate went away", zoneDups)
+	}
+}
@@ -0,0 +1,96 @@
+package hc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+type dnsChecker struct {
+	port   string
+	qname  string
+	qtype  uint16
+	rcode  int
+	answer string
+	client *dns.Client
+}
+
+func init() {
+	Register("dns", newDNSChecker)
+}
+
+func newDNSChecker(c *Config) (Checker, error) {
+	d := &dnsChecker{
+		port:   strconv.Itoa(c.Port),
+		qname:  dns.Fqdn(c.Query),
+		qtype:  dns.TypeA,
+		rcode:  dns.RcodeSuccess,
+		answer: c.Answer,
+	}
+
+	if c.Port == 0 {
+		d.port = "53"
+	}
+
+	if len(c.Query) == 0 {
+		return nil, errors.New("dns check needs a query name")
+	}
+
+	if len(c.QueryType) > 0 {
+		qtype, ok := dns.StringToType[strings.ToUpper(c.QueryType)]
+		if !ok {
+			return nil, fmt.Errorf("unknown query type %s", c.QueryType)
+		}
+		d.qtype = qtype
+	}
+
+	if len(c.Rcode) > 0 {
+		rcode, ok := dns.StringToRcode[strings.ToUpper(c.Rcode)]
+		if !ok {
+			return nil, fmt.Errorf("unknown rcode %s", c.Rcode)
+		}
+		d.rcode = rcode
+	}
+
+	switch c.Transport {
+	case "", "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("unknown transport %s", c.Transport)
+	}
+
+	d.client = &dns.Client{Net: c.Transport, Timeout: c.timeout()}
+
+	return d, nil
+}
+
+func (d *dnsChecker) Check(addr string) error {
+	m := new(dns.Msg)
+	m.SetQuestion(d.qname, d.qtype)
+
+	r, _, err := d.client.Exchange(m, net.JoinHostPort(addr, d.port))
+	if err != nil {
+		return err
+	}
+
+	if r.Rcode != d.rcode {
+		return fmt.Errorf("unexpected rcode %s", dns.RcodeToString[r.Rcode])
+	}
+
+	if len(d.answer) == 0 {
+		return nil
+	}
+
+	for _, rr := range r.Answer {
+		// compare the rdata only, "1.2.3.4" for an A record
+		rdata := strings.TrimPrefix(rr.String(), rr.Header().String())
+		if rdata == d.answer || rdata == dns.Fqdn(d.answer) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected answer %s not found", d.answer)
+}
@@ -0,0 +1,133 @@
+package hc
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func dnsTestHandler(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	q := r.Question[0]
+	switch q.Name {
+	case "ok.test.":
+		switch q.Qtype {
+		case dns.TypeA:
+			rr, _ := dns.NewRR("ok.test. 60 IN A 1.2.3.4")
+			rr2, _ := dns.NewRR("ok.test. 60 IN A 1.2.3.5")
+			m.Answer = append(m.Answer, rr, rr2)
+		case dns.TypeTXT:
+			rr, _ := dns.NewRR(`ok.test. 60 IN TXT "healthy"`)
+			m.Answer = append(m.Answer, rr)
+		}
+	case "alias.test.":
+		rr, _ := dns.NewRR("alias.test. 60 IN CNAME ok.test.")
+		m.Answer = append(m.Answer, rr)
+	case "refused.test.":
+		m.Rcode = dns.RcodeRefused
+	default:
+		m.Rcode = dns.RcodeNameError
+	}
+
+	w.WriteMsg(m)
+}
+
+// startDNS runs a test server for one transport and returns its port.
+func startDNS(t *testing.T, network string) int {
+	started := make(chan struct{})
+	srv := &dns.Server{
+		Handler:           dns.HandlerFunc(dnsTestHandler),
+		NotifyStartedFunc: func() { close(started) },
+	}
+
+	var addr string
+	if network == "udp" {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.PacketConn = pc
+		addr = pc.LocalAddr().String()
+	} else {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.Listener = l
+		addr = l.Addr().String()
+	}
+
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+
+	_, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.Atoi(port)
+
+	return p
+}
+
+func TestDNSCheck(t *testing.T) {
+	udp, tcp := startDNS(t, "udp"), startDNS(t, "tcp")
+
+	tests := []struct {
+		name string
+		conf Config
+		ok   bool
+	}{
+		{"answer", Config{Query: "ok.test"}, true},
+		{"nxdomain", Config{Query: "missing.test"}, false},
+		{"expected nxdomain", Config{Query: "missing.test", Rcode: "nxdomain"}, true},
+		{"refused", Config{Query: "refused.test"}, false},
+		{"expected refused", Config{Query: "refused.test", Rcode: "REFUSED"}, true},
+		{"expected answer", Config{Query: "ok.test", Answer: "1.2.3.5"}, true},
+		{"other answer", Config{Query: "ok.test", Answer: "1.2.3.6"}, false},
+		{"txt", Config{Query: "ok.test", QueryType: "txt", Answer: `"healthy"`}, true},
+		{"txt not a", Config{Query: "ok.test", QueryType: "TXT", Answer: "1.2.3.4"}, false},
+		{"cname target", Config{Query: "alias.test", QueryType: "CNAME", Answer: "ok.test"}, true},
+		{"cname fqdn", Config{Query: "alias.test", QueryType: "CNAME", Answer: "ok.test."}, true},
+		{"no records", Config{Query: "ok.test", QueryType: "MX", Answer: "mail.test"}, false},
+	}
+
+	for _, tt := range tests {
+		for _, transport := range []struct {
+			net  string
+			port int
+		}{{"", udp}, {"udp", udp}, {"tcp", tcp}} {
+			c := tt.conf
+			c.Type = "dns"
+			c.Port = transport.port
+			c.Transport = transport.net
+
+			err := runCheck(t, &c, "127.0.0.1")
+			if (err == nil) != tt.ok {
+				t.Errorf("%s over %q: got error %v, want ok %v", tt.name, transport.net, err, tt.ok)
+			}
+		}
+	}
+
+	// each transport only reaches its own server
+	for _, c := range []Config{
+		{Type: "dns", Query: "ok.test", Transport: "tcp", Port: udp, Timeout: 1},
+		{Type: "dns", Query: "ok.test", Transport: "udp", Port: tcp, Timeout: 1},
+	} {
+		if err := runCheck(t, &c, "127.0.0.1"); err == nil {
+			t.Errorf("%s check reached the other transport's server", c.Transport)
+		}
+	}
+
+	for _, bad := range []Config{
+		{Type: "dns"},
+		{Type: "dns", Query: "ok.test", QueryType: "BOGUS"},
+		{Type: "dns", Query: "ok.test", Rcode: "maybe"},
+		{Type: "dns", Query: "ok.test", Transport: "quic"},
+	} {
+		if _, err := newChecker(&bad); err == nil {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+}
@@ -1 +1,161 @@
 package hc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInterval = 5
+	defaultTimeout  = 3
+	defaultRise     = 2
+	defaultFall     = 3
+
+	// flap damping, see Config.HalfLife
+	flapPenalty     = 1000
+	defaultSuppress = 2000
+	defaultReuse    = 750
+	maxPenaltyRatio = 16 // of reuse, bounds suppression to 4 half lives
+)
+
+var ErrNotSupported = errors.New("health check type not supported")
+
+// Checker probes one address, a nil error means the address is healthy.
+type Checker interface {
+	Check(addr string) error
+}
+
+// Factory builds a Checker for a check configuration.
+type Factory func(c *Config) (Checker, error)
+
+// Config is the "hc" section of a node. Interval and Timeout are in
+// seconds. A node is marked down after Fall consecutive failures and up
+// again after Rise consecutive successes. The remaining fields only
+// apply to some check types.
+type Config struct {
+	Type     string `json:"type"`
+	Port     int    `json:"port"`
+	Interval int    `json:"interval,omitempty"`
+	Timeout  int    `json:"timeout,omitempty"`
+	Rise     int    `json:"rise,omitempty"`
+	Fall     int    `json:"fall,omitempty"`
+
+	// Flap damping is enabled by HalfLife, in seconds. Every transition
+	// to down adds a penalty of 1000 that decays exponentially with the
+	// half life. The node is held down while the penalty is above
+	// Suppress, until it decays below Reuse.
+	HalfLife int `json:"damp_half_life,omitempty"`
+	Suppress int `json:"damp_suppress,omitempty"`
+	Reuse    int `json:"damp_reuse,omitempty"`
+
+	// http, https
+	Path       string `json:"path,omitempty"`
+	Host       string `json:"host,omitempty"`
+	Status     []int  `json:"expect_status,omitempty"`
+	Body       string `json:"expect_body,omitempty"`
+	BodyRegex  string `json:"expect_body_regex,omitempty"`
+	SNI        string `json:"sni,omitempty"`
+	SkipVerify bool   `json:"skip_verify,omitempty"`
+	CAFile     string `json:"ca_file,omitempty"`
+
+	// dns
+	Query     string `json:"query,omitempty"`
+	QueryType string `json:"query_type,omitempty"`
+	Transport string `json:"transport,omitempty"`
+	Rcode     string `json:"expect_rcode,omitempty"`
+	Answer    string `json:"expect_answer,omitempty"`
+}
+
+var (
+	regMutex sync.RWMutex
+
+	registry = make(map[string]Factory)
+)
+
+// Register makes a check type available, it is meant to be called
+// from the init function of the file implementing the check.
+func Register(ctype string, f Factory) {
+	regMutex.Lock()
+	defer regMutex.Unlock()
+
+	if _, ok := registry[ctype]; ok {
+		panic("hc: Register called twice for type " + ctype)
+	}
+	registry[ctype] = f
+}
+
+func newChecker(c *Config) (Checker, error) {
+	regMutex.RLock()
+	f, ok := registry[c.Type]
+	regMutex.RUnlock()
+
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	return f(c)
+}
+
+// Validate returns the error setting up a check from c would give.
+func (c *Config) Validate() error {
+	_, err := newChecker(c)
+	return err
+}
+
+// Key identifies the check of c against addr. It covers all of c, a
+// node whose check changes gets a new one, which takes over the state of
+// the old one, and two platforms checking an address differently don't
+// share one.
+func (c *Config) Key(addr string) string {
+	js, _ := json.Marshal(c)
+	h := fnv.New32a()
+	h.Write(js)
+
+	return fmt.Sprintf("%s:%d-%s-%08x", addr, c.Port, c.Type, h.Sum32())
+}
+
+func (c *Config) interval() time.Duration {
+	if c.Interval > 0 {
+		return time.Duration(c.Interval) * time.Second
+	}
+	return defaultInterval * time.Second
+}
+
+func (c *Config) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return time.Duration(c.Timeout) * time.Second
+	}
+	return defaultTimeout * time.Second
+}
+
+func (c *Config) rise() int {
+	if c.Rise > 0 {
+		return c.Rise
+	}
+	return defaultRise
+}
+
+func (c *Config) fall() int {
+	if c.Fall > 0 {
+		return c.Fall
+	}
+	return defaultFall
+}
+
+func (c *Config) suppress() float64 {
+	if c.Suppress > 0 {
+		return float64(c.Suppress)
+	}
+	return defaultSuppress
+}
+
+func (c *Config) reuse() float64 {
+	if c.Reuse > 0 {
+		return float64(c.Reuse)
+	}
+	return defaultReuse
+}
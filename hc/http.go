@@ -0,0 +1,161 @@
+package hc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// only this much of the body is searched for the expected content
+const maxBodySize = 64 * 1024
+
+type httpChecker struct {
+	scheme string
+	port   string
+	path   string
+	host   string
+	status []int
+	body   string
+	re     *regexp.Regexp
+	client *http.Client
+}
+
+func init() {
+	Register("http", newHTTPChecker)
+	Register("https", newHTTPChecker)
+}
+
+func newHTTPChecker(c *Config) (Checker, error) {
+	h := &httpChecker{
+		scheme: c.Type,
+		port:   strconv.Itoa(c.Port),
+		path:   c.Path,
+		host:   c.Host,
+		status: c.Status,
+		body:   c.Body,
+	}
+
+	if c.Port == 0 {
+		h.port = "80"
+		if c.Type == "https" {
+			h.port = "443"
+		}
+	}
+
+	if !strings.HasPrefix(h.path, "/") {
+		h.path = "/" + h.path
+	}
+
+	if len(c.BodyRegex) > 0 {
+		re, err := regexp.Compile(c.BodyRegex)
+		if err != nil {
+			return nil, err
+		}
+		h.re = re
+	}
+
+	transport := &http.Transport{
+		DisableKeepAlives: true,
+	}
+
+	if c.Type == "https" {
+		tlsConfig := &tls.Config{
+			ServerName:         c.SNI,
+			InsecureSkipVerify: c.SkipVerify,
+		}
+		if len(tlsConfig.ServerName) == 0 {
+			tlsConfig.ServerName = c.Host
+		}
+
+		if len(c.CAFile) > 0 {
+			pem, err := ioutil.ReadFile(c.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in %s", c.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	h.client = &http.Client{
+		Transport: transport,
+		Timeout:   c.timeout(),
+		// the node answering is what counts, not where it redirects to
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return h, nil
+}
+
+func (h *httpChecker) Check(addr string) error {
+	url := h.scheme + "://" + net.JoinHostPort(addr, h.port) + h.path
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if len(h.host) > 0 {
+		req.Host = h.host
+	}
+	req.Header.Set("User-Agent", "gslb-dns health check")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !h.statusOK(resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if len(h.body) == 0 && h.re == nil {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxBodySize))
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return err
+	}
+
+	if len(h.body) > 0 && !strings.Contains(string(body), h.body) {
+		return errors.New("expected body content not found")
+	}
+
+	if h.re != nil && !h.re.Match(body) {
+		return errors.New("body does not match expected pattern")
+	}
+
+	return nil
+}
+
+// statusOK accepts any 2xx status unless expected codes are configured.
+func (h *httpChecker) statusOK(code int) bool {
+	if len(h.status) == 0 {
+		return code >= 200 && code < 300
+	}
+
+	for _, s := range h.status {
+		if s == code {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,157 @@
+package hc
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// splitServer returns the address and port of a test server.
+func splitServer(t *testing.T, srv *httptest.Server) (string, int) {
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, _ := strconv.Atoi(port)
+
+	return host, p
+}
+
+func runCheck(t *testing.T, c *Config, addr string) error {
+	checker, err := newChecker(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return checker.Check(addr)
+}
+
+func TestHTTPCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			fmt.Fprint(w, "status: ok, version 1.2.3")
+		case "/host":
+			fmt.Fprint(w, r.Host)
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		case "/teapot":
+			w.WriteHeader(http.StatusTeapot)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	addr, port := splitServer(t, srv)
+
+	tests := []struct {
+		name string
+		conf Config
+		ok   bool
+	}{
+		{"2xx", Config{Path: "/ok"}, true},
+		{"404", Config{Path: "/missing"}, false},
+		{"path without slash", Config{Path: "ok"}, true},
+		{"redirect is not 2xx", Config{Path: "/moved"}, false},
+		{"status list", Config{Path: "/moved", Status: []int{200, 302}}, true},
+		{"status list excludes 200", Config{Path: "/ok", Status: []int{204}}, false},
+		{"other status", Config{Path: "/teapot", Status: []int{418}}, true},
+		{"body", Config{Path: "/ok", Body: "status: ok"}, true},
+		{"body missing", Config{Path: "/ok", Body: "status: down"}, false},
+		{"regex", Config{Path: "/ok", BodyRegex: `version \d+\.\d+`}, true},
+		{"regex no match", Config{Path: "/ok", BodyRegex: `^version`}, false},
+		{"body and regex", Config{Path: "/ok", Body: "ok", BodyRegex: `1\.2\.3$`}, true},
+		{"host", Config{Path: "/host", Host: "www.example.com", Body: "www.example.com"}, true},
+	}
+
+	for _, tt := range tests {
+		c := tt.conf
+		c.Type = "http"
+		c.Port = port
+
+		err := runCheck(t, &c, addr)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+
+	if _, err := newChecker(&Config{Type: "http", BodyRegex: "("}); err == nil {
+		t.Error("invalid regex accepted")
+	}
+}
+
+func TestHTTPSCheck(t *testing.T) {
+	var lastSNI string
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastSNI = r.TLS.ServerName
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	addr, port := splitServer(t, srv)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the certificate of the test server is for example.com and 127.0.0.1
+	tests := []struct {
+		name string
+		conf Config
+		ok   bool
+		sni  string
+	}{
+		{"unknown CA", Config{}, false, ""},
+		{"skip verify", Config{SkipVerify: true}, true, ""},
+		{"ca file", Config{CAFile: caFile}, true, ""},
+		{"sni", Config{CAFile: caFile, SNI: "example.com"}, true, "example.com"},
+		{"sni from host", Config{CAFile: caFile, Host: "example.com"}, true, "example.com"},
+		{"sni not in certificate", Config{CAFile: caFile, SNI: "other.test"}, false, ""},
+		{"skip verify with sni", Config{SkipVerify: true, SNI: "other.test"}, true, "other.test"},
+	}
+
+	for _, tt := range tests {
+		c := tt.conf
+		c.Type = "https"
+		c.Port = port
+
+		lastSNI = ""
+		err := runCheck(t, &c, addr)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok %v", tt.name, err, tt.ok)
+			continue
+		}
+		if tt.ok && lastSNI != tt.sni {
+			t.Errorf("%s: server saw SNI %q, want %q", tt.name, lastSNI, tt.sni)
+		}
+	}
+
+	if _, err := newChecker(&Config{Type: "https", CAFile: filepath.Join(dir, "missing.pem")}); err == nil {
+		t.Error("missing ca file accepted")
+	}
+	junk := filepath.Join(dir, "junk.pem")
+	if err := os.WriteFile(junk, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newChecker(&Config{Type: "https", CAFile: junk}); err == nil {
+		t.Error("ca file without certificates accepted")
+	}
+}
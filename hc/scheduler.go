@@ -0,0 +1,353 @@
+package hc
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rench1988/gslb-dns/log"
+)
+
+// Scheduler owns one goroutine per registered check and keeps the
+// health state of every checked address.
+type Scheduler struct {
+	mu    sync.RWMutex
+	units map[string]*unit
+}
+
+type unit struct {
+	key     string
+	addr    string
+	conf    Config
+	checker Checker
+	stop    chan struct{}
+
+	healthy    bool // by rise and fall alone
+	suppressed bool // held down by flap damping
+	penalty    float64
+	penaltyAt  time.Time
+	successes  int // consecutive
+	failures   int // consecutive
+	lastCheck  time.Time
+	lastErr    error
+	lastChange time.Time
+	upSince    time.Time     // when it last came up, zero if it never went down
+	srtt       time.Duration // smoothed duration of successful checks
+}
+
+// a new RTT sample counts for 1/rttSmoothing of the smoothed RTT, as in
+// TCP
+const rttSmoothing = 8
+
+// Std is the scheduler used by the zone package.
+var Std = NewScheduler()
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{units: make(map[string]*unit)}
+}
+
+// Add starts checking addr with c and returns the key of the check. A
+// check already registered under the same key is left alone. A new check
+// of an address, port and type that's already checked with another
+// config takes over its state, so changing the config of a down node
+// doesn't bring it back up.
+func (s *Scheduler) Add(addr string, c *Config) (string, error) {
+	key := c.Key(addr)
+
+	checker, err := newChecker(c)
+	if err != nil {
+		return key, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.units[key]; ok {
+		return key, nil
+	}
+
+	u := &unit{
+		key:     key,
+		addr:    addr,
+		conf:    *c,
+		checker: checker,
+		stop:    make(chan struct{}),
+		healthy: true,
+	}
+	if prev := s.similar(u); prev != nil {
+		u.carry(prev)
+	}
+	s.units[key] = u
+
+	go s.run(u)
+
+	return key, nil
+}
+
+// similar returns the unit checking the address, port and type of u
+// that was checked last, s.mu must be held.
+func (s *Scheduler) similar(u *unit) *unit {
+	var res *unit
+
+	for _, o := range s.units {
+		if o.addr != u.addr || o.conf.Port != u.conf.Port || o.conf.Type != u.conf.Type {
+			continue
+		}
+		if res == nil || o.lastCheck.After(res.lastCheck) || (o.lastCheck.Equal(res.lastCheck) && o.key < res.key) {
+			res = o
+		}
+	}
+
+	return res
+}
+
+// carry copies the health state of prev to u.
+func (u *unit) carry(prev *unit) {
+	u.healthy = prev.healthy
+	u.suppressed = prev.suppressed
+	u.penalty = prev.penalty
+	u.penaltyAt = prev.penaltyAt
+	u.successes = prev.successes
+	u.failures = prev.failures
+	u.lastCheck = prev.lastCheck
+	u.lastErr = prev.lastErr
+	u.lastChange = prev.lastChange
+	u.upSince = prev.upSince
+	u.srtt = prev.srtt
+}
+
+// Del stops the check registered under key.
+func (s *Scheduler) Del(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.units[key]; ok {
+		close(u.stop)
+		delete(s.units, key)
+	}
+}
+
+func (s *Scheduler) Exists(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.units[key]
+	return ok
+}
+
+// RTT returns the smoothed round trip time of the check registered
+// under key, false when there's none yet.
+func (s *Scheduler) RTT(key string) (time.Duration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.units[key]
+	if !ok || u.srtt == 0 {
+		return 0, false
+	}
+
+	return u.srtt, true
+}
+
+// UpSince returns when the check registered under key came back up, a
+// zero time when it's down or has been up since it was added.
+func (s *Scheduler) UpSince(key string) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.units[key]
+	if !ok || !u.up() {
+		return time.Time{}
+	}
+
+	return u.upSince
+}
+
+// IsHealthy reports the state of the check registered under key.
+// Addresses that aren't checked are considered healthy.
+func (s *Scheduler) IsHealthy(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.units[key]
+	if !ok {
+		return true
+	}
+
+	return u.up()
+}
+
+func (u *unit) up() bool {
+	return u.healthy && !u.suppressed
+}
+
+func (s *Scheduler) run(u *unit) {
+	interval := u.conf.interval()
+
+	// spread the checks out over the interval
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(interval))))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-u.stop:
+			return
+		case <-timer.C:
+		}
+
+		start := time.Now()
+		err := u.checker.Check(u.addr)
+		now := time.Now()
+
+		s.mu.Lock()
+		s.update(u, err, now.Sub(start), now)
+		s.mu.Unlock()
+
+		timer.Reset(interval)
+	}
+}
+
+// update records the result of a check that took rtt and finished at
+// now, s.mu must be held.
+func (s *Scheduler) update(u *unit, err error, rtt time.Duration, now time.Time) {
+	u.lastCheck = now
+	u.lastErr = err
+
+	s.decay(u, now)
+
+	if err == nil {
+		if u.srtt == 0 {
+			u.srtt = rtt
+		} else {
+			u.srtt += (rtt - u.srtt) / rttSmoothing
+		}
+
+		u.successes++
+		u.failures = 0
+
+		if !u.healthy && u.successes >= u.conf.rise() {
+			u.healthy = true
+			s.transition(u, now, fmt.Sprintf("%d consecutive successes", u.successes))
+		}
+		return
+	}
+
+	u.failures++
+	u.successes = 0
+
+	if u.healthy && u.failures >= u.conf.fall() {
+		u.healthy = false
+		s.transition(u, now, fmt.Sprintf("%d consecutive failures, last: %s", u.failures, err))
+		s.penalize(u, now)
+	}
+}
+
+func (s *Scheduler) transition(u *unit, now time.Time, reason string) {
+	u.lastChange = now
+	if u.up() {
+		u.upSince = now
+	}
+
+	state := "down"
+	if u.healthy {
+		state = "up"
+	}
+	if u.suppressed {
+		state += " (suppressed)"
+	}
+
+	log.Printf("hc: %s is %s: %s\n", u.key, state, reason)
+}
+
+// penalize charges a flap to u and suppresses it once the penalty
+// crosses the suppress threshold.
+func (s *Scheduler) penalize(u *unit, now time.Time) {
+	if u.conf.HalfLife <= 0 {
+		return
+	}
+
+	u.penalty += flapPenalty
+	if max := u.conf.reuse() * maxPenaltyRatio; u.penalty > max {
+		u.penalty = max
+	}
+	u.penaltyAt = now
+
+	if !u.suppressed && u.penalty >= u.conf.suppress() {
+		u.suppressed = true
+		s.transition(u, now, fmt.Sprintf("flapping, penalty %.0f", u.penalty))
+	}
+}
+
+// decay lets the flap penalty of u decay with the configured half life
+// and lifts the suppression once it falls below the reuse threshold.
+func (s *Scheduler) decay(u *unit, now time.Time) {
+	if u.conf.HalfLife <= 0 || u.penalty == 0 {
+		return
+	}
+
+	halfLife := time.Duration(u.conf.HalfLife) * time.Second
+	u.penalty *= math.Pow(0.5, float64(now.Sub(u.penaltyAt))/float64(halfLife))
+	u.penaltyAt = now
+
+	if u.penalty < 1 {
+		u.penalty = 0
+	}
+
+	if u.suppressed && u.penalty < u.conf.reuse() {
+		u.suppressed = false
+		s.transition(u, now, fmt.Sprintf("penalty decayed to %.0f", u.penalty))
+	}
+}
+
+// Status is a snapshot of the state of one check.
+type Status struct {
+	Key        string    `json:"key"`
+	Addr       string    `json:"addr"`
+	Port       int       `json:"port"`
+	Type       string    `json:"type"`
+	Healthy    bool      `json:"healthy"`
+	Suppressed bool      `json:"suppressed"`
+	Penalty    int       `json:"penalty"`
+	LastCheck  time.Time `json:"last_check"`
+	LastError  string    `json:"last_error"`
+	Successes  int       `json:"successes"`
+	Failures   int       `json:"failures"`
+	LastChange time.Time `json:"last_change"`
+	RTT        float64   `json:"rtt_ms"`
+}
+
+// Status returns the state of all checks ordered by key.
+func (s *Scheduler) Status() []Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make([]Status, 0, len(s.units))
+
+	for _, u := range s.units {
+		st := Status{
+			Key:        u.key,
+			Addr:       u.addr,
+			Port:       u.conf.Port,
+			Type:       u.conf.Type,
+			Healthy:    u.up(),
+			Suppressed: u.suppressed,
+			Penalty:    int(u.penalty),
+			LastCheck:  u.lastCheck,
+			Successes:  u.successes,
+			Failures:   u.failures,
+			LastChange: u.lastChange,
+			RTT:        float64(u.srtt) / float64(time.Millisecond),
+		}
+		if u.lastErr != nil {
+			st.LastError = u.lastErr.Error()
+		}
+		res = append(res, st)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+
+	return res
+}
@@ -0,0 +1,165 @@
+package hc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// the "manual" check never finishes, tests call update instead
+type manualChecker struct{}
+
+func (manualChecker) Check(addr string) error { select {} }
+
+func init() {
+	Register("manual", func(c *Config) (Checker, error) { return manualChecker{}, nil })
+}
+
+var errDown = errors.New("down")
+
+func TestReplaceKeepsState(t *testing.T) {
+	s := NewScheduler()
+
+	old, err := s.Add("10.0.0.1", &Config{Type: "manual", Port: 80, Path: "/a", Fall: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Del(old)
+
+	for i := 0; i < 2; i++ {
+		s.update(s.units[old], errDown, 0, time.Now())
+	}
+	if s.IsHealthy(old) {
+		t.Fatal("not down after fall failures")
+	}
+
+	// the path changed
+	key, err := s.Add("10.0.0.1", &Config{Type: "manual", Port: 80, Path: "/b", Fall: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Del(key)
+
+	if key == old {
+		t.Fatal("same key for another path")
+	}
+	s.Del(old)
+
+	if s.IsHealthy(key) {
+		t.Error("down node up after its check changed")
+	}
+	if u := s.units[key]; u.failures != 2 || u.lastErr != errDown {
+		t.Errorf("failures %d and last error %v not carried over", u.failures, u.lastErr)
+	}
+
+	// another port is another check
+	other, err := s.Add("10.0.0.1", &Config{Type: "manual", Port: 8080, Path: "/a", Fall: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Del(other)
+
+	if !s.IsHealthy(other) {
+		t.Error("check of another port down")
+	}
+}
+
+func TestRiseFall(t *testing.T) {
+	s := NewScheduler()
+	u := &unit{key: "test", conf: Config{Rise: 2, Fall: 3}, healthy: true}
+	start := time.Date(2026, 11, 10, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		err  error
+		up   bool
+		note string
+	}{
+		{errDown, true, "1 failure"},
+		{errDown, true, "2 failures"},
+		{nil, true, "a success resets the failures"},
+		{errDown, true, "1 failure"},
+		{errDown, true, "2 failures"},
+		{errDown, false, "3 failures"},
+		{nil, false, "1 success"},
+		{errDown, false, "a failure resets the successes"},
+		{nil, false, "1 success"},
+		{nil, true, "2 successes"},
+		{nil, true, "still up"},
+	}
+
+	for i, step := range steps {
+		now := start.Add(time.Duration(i) * time.Second)
+		s.update(u, step.err, time.Millisecond, now)
+
+		if u.up() != step.up {
+			t.Fatalf("step %d, %s: up %v, want %v", i, step.note, u.up(), step.up)
+		}
+	}
+
+	if want := start.Add(9 * time.Second); !u.upSince.Equal(want) || !u.lastChange.Equal(want) {
+		t.Errorf("up since %s, changed %s, want %s", u.upSince, u.lastChange, want)
+	}
+	if u.penalty != 0 {
+		t.Errorf("penalty %v without damping", u.penalty)
+	}
+}
+
+func TestFlapDamping(t *testing.T) {
+	s := NewScheduler()
+	u := &unit{key: "test", conf: Config{Rise: 1, Fall: 1, HalfLife: 60, Suppress: 1500, Reuse: 750}, healthy: true}
+	start := time.Date(2026, 11, 10, 12, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return start.Add(time.Duration(sec) * time.Second) }
+
+	// the first flap is charged but not suppressed
+	s.update(u, errDown, 0, at(0))
+	if u.penalty != flapPenalty || u.suppressed {
+		t.Fatalf("penalty %v, suppressed %v after one flap", u.penalty, u.suppressed)
+	}
+	s.update(u, nil, 0, at(1))
+	if !u.up() {
+		t.Fatal("not up after rise successes")
+	}
+
+	// the second one a second later crosses the threshold
+	s.update(u, errDown, 0, at(2))
+	if !u.suppressed {
+		t.Fatalf("not suppressed with penalty %v", u.penalty)
+	}
+	s.update(u, nil, 0, at(3))
+	if !u.healthy || u.up() {
+		t.Fatalf("healthy %v, up %v, want healthy but held down", u.healthy, u.up())
+	}
+
+	// about 1970 decays below 750 after 84s
+	s.update(u, nil, 0, at(62))
+	if !u.suppressed {
+		t.Errorf("suppression lifted after one half life, penalty %v", u.penalty)
+	}
+	s.update(u, nil, 0, at(92))
+	if u.suppressed || !u.up() {
+		t.Errorf("still suppressed with penalty %v", u.penalty)
+	}
+	if !u.upSince.Equal(at(92)) {
+		t.Errorf("up since %s, want when the suppression lifted", u.upSince)
+	}
+
+	// the penalty is capped, so the suppression ends in at most 4 half
+	// lives after the flapping stops
+	for i := 0; i < 40; i += 2 {
+		s.update(u, errDown, 0, at(100+i))
+		s.update(u, nil, 0, at(101+i))
+	}
+	if max := 750.0 * maxPenaltyRatio; u.penalty > max {
+		t.Errorf("penalty %v above %v", u.penalty, max)
+	}
+	s.update(u, nil, 0, at(140+4*60))
+	if u.suppressed {
+		t.Errorf("suppressed 4 half lives after the last flap, penalty %v", u.penalty)
+	}
+
+	// fully decayed
+	s.update(u, nil, 0, at(140+20*60))
+	if u.penalty != 0 {
+		t.Errorf("penalty %v after 20 half lives", u.penalty)
+	}
+}
@@ -0,0 +1,34 @@
+package hc
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+type tcpChecker struct {
+	port    string
+	timeout time.Duration
+}
+
+func init() {
+	Register("tcp", newTCPChecker)
+}
+
+func newTCPChecker(c *Config) (Checker, error) {
+	if c.Port == 0 {
+		return nil, errors.New("tcp check needs a port")
+	}
+
+	return &tcpChecker{port: strconv.Itoa(c.Port), timeout: c.timeout()}, nil
+}
+
+func (t *tcpChecker) Check(addr string) error {
+	c, err := net.DialTimeout("tcp", net.JoinHostPort(addr, t.port), t.timeout)
+	if err != nil {
+		return err
+	}
+
+	return c.Close()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/rench1988/gslb-dns/hc"
+	"github.com/rench1988/gslb-dns/log"
+	"github.com/rench1988/gslb-dns/metrics"
+	"github.com/rench1988/gslb-dns/zone"
+)
+
+var hcTemplate = template.Must(template.New("hc").Funcs(template.FuncMap{
+	"mul100": func(f float64) float64 { return f * 100 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>gslb-dns health checks</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 3px 8px; text-align: left; }
+.up { background: #dfd; }
+.down { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>Health checks</h1>
+<table>
+<tr>
+<th>Address</th><th>Port</th><th>Type</th><th>Status</th><th>Last check</th>
+<th>Last error</th><th>Successes</th><th>Failures</th><th>RTT</th><th>Last transition</th>
+</tr>
+{{range .Checks}}
+<tr class="{{if .Healthy}}up{{else}}down{{end}}">
+<td>{{.Addr}}</td><td>{{.Port}}</td><td>{{.Type}}</td>
+<td>{{if .Healthy}}up{{else}}down{{end}}{{if .Suppressed}} (suppressed, penalty {{.Penalty}}){{end}}</td>
+<td>{{if not .LastCheck.IsZero}}{{.LastCheck.Format "2006-01-02 15:04:05"}}{{end}}</td>
+<td>{{.LastError}}</td>
+<td>{{.Successes}}</td><td>{{.Failures}}</td>
+<td>{{if .RTT}}{{printf "%.1f ms" .RTT}}{{end}}</td>
+<td>{{if not .LastChange.IsZero}}{{.LastChange.Format "2006-01-02 15:04:05"}}{{end}}</td>
+</tr>
+{{end}}
+</table>
+<h1>Node weights</h1>
+<table>
+<tr>
+<th>Platform</th><th>Area</th><th>Address</th><th>State</th><th>Weight</th>
+<th>Scheduled</th><th>Load</th><th>Ramp</th><th>Effective</th>
+</tr>
+{{range .Weights}}
+<tr class="{{if .Healthy}}up{{else}}down{{end}}">
+<td>{{.Platform}}</td><td>{{.Area}}</td><td>{{.Addr}}</td><td>{{.State}}</td><td>{{.Weight}}</td>
+<td>{{printf "%.1f" .Scheduled}}</td><td>{{printf "%.0f%%" (mul100 .Load)}}</td>
+<td>{{printf "%.0f%%" (mul100 .Ramp)}}</td><td>{{printf "%.1f" .Effective}}</td>
+</tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+func httpServer(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hc", hcHTMLHandler)
+	mux.HandleFunc("/hc.json", hcJSONHandler)
+	mux.HandleFunc("/weights.json", weightsJSONHandler)
+	mux.Handle("/metrics", metrics.Handler())
+	apiHandlers(mux)
+
+	log.Printf("Opening http on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatalf("gslb-dns: failed to setup http %s: %s", addr, err)
+	}
+}
+
+func hcHTMLHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	data := struct {
+		Checks  []hc.Status
+		Weights []zone.NodeWeight
+	}{hc.Std.Status(), nodeWeights()}
+
+	if err := hcTemplate.Execute(w, data); err != nil {
+		log.Println("Error rendering health check status", err)
+	}
+}
+
+func hcJSONHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(hc.Std.Status()); err != nil {
+		log.Println("Error writing health check status", err)
+	}
+}
+
+// weightsJSONHandler shows the weights the nodes of every platform get
+// right now, with schedules, load feedback and slow start applied.
+func weightsJSONHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(nodeWeights()); err != nil {
+		log.Println("Error writing node weights", err)
+	}
+}
+
+func nodeWeights() []zone.NodeWeight {
+	ps := zone.CurrentPlats()
+
+	res := []zone.NodeWeight{}
+	for _, name := range ps.PlatNames() {
+		weights, err := ps.NodeWeights(name)
+		if err != nil {
+			continue
+		}
+		res = append(res, weights...)
+	}
+
+	return res
+}
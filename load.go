@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rench1988/gslb-dns/log"
+	"github.com/rench1988/gslb-dns/metrics"
+	"github.com/rench1988/gslb-dns/zone"
+)
+
+// loadFeed is where the current load of the nodes comes from, the URL is
+// pulled when it's set and the file is read otherwise. The loads of a
+// file hold until it changes, whoever writes it keeps it current.
+type loadFeed struct {
+	File     string `json:"file"`
+	URL      string `json:"url"`
+	Interval int    `json:"interval"` // seconds, 10 by default
+	MaxAge   int    `json:"maxAge"`   // seconds the loads of the URL are kept when pulling fails, 3 intervals by default
+}
+
+// the feed is a small JSON object, don't read more than this of it
+const maxLoadFeedSize = 16 * 1024 * 1024
+
+var loadClient = &http.Client{Timeout: 5 * time.Second}
+
+// the load file in use and its modification time
+var lastLoadFile string
+var lastLoadRead time.Time
+
+func (f *loadFeed) enabled() bool {
+	return len(f.URL) > 0 || len(f.File) > 0
+}
+
+func (f *loadFeed) interval() time.Duration {
+	if f.Interval > 0 {
+		return time.Duration(f.Interval) * time.Second
+	}
+
+	return 10 * time.Second
+}
+
+func (f *loadFeed) maxAge() time.Duration {
+	if f.MaxAge > 0 {
+		return time.Duration(f.MaxAge) * time.Second
+	}
+
+	return 3 * f.interval()
+}
+
+func loadsReader() {
+	// when the loads in use were read, zero without any
+	var updated time.Time
+
+	for {
+		feed := getConf().LoadFeed
+
+		if !feed.enabled() {
+			if !updated.IsZero() {
+				log.Println("Load feed removed, using the configured weights")
+				zone.SetLoads(nil)
+				updated = time.Time{}
+				lastLoadFile = ""
+			}
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		loads, err := feed.read()
+		if err != nil {
+			log.Printf("Error reading load feed: %s", err)
+		}
+		if loads != nil {
+			zone.SetLoads(loads)
+			updated = time.Now()
+		}
+
+		if len(feed.URL) > 0 && !updated.IsZero() && time.Since(updated) > feed.maxAge() {
+			log.Printf("Load feed not updated since %s, using the configured weights", updated.Format(time.RFC3339))
+			zone.SetLoads(nil)
+			updated = time.Time{}
+		}
+
+		time.Sleep(feed.interval())
+	}
+}
+
+// read returns the loads of the feed, nil when the file didn't change.
+func (f *loadFeed) read() (zone.Loads, error) {
+	if len(f.URL) > 0 {
+		loads, err := pullLoads(f.URL)
+		metrics.Reload("load", err)
+		return loads, err
+	}
+
+	file, err := os.Stat(f.File)
+	if err != nil {
+		return nil, err
+	}
+
+	modTime := file.ModTime()
+	if lastLoadFile == f.File && !modTime.After(lastLoadRead) {
+		return nil, nil
+	}
+
+	loads, err := readLoads(f.File)
+	metrics.Reload("load", err)
+	if err != nil {
+		return nil, err
+	}
+
+	lastLoadFile = f.File
+	lastLoadRead = modTime
+
+	return loads, nil
+}
+
+func readLoads(fileName string) (zone.Loads, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return decodeLoads(file)
+}
+
+func pullLoads(url string) (zone.Loads, error) {
+	resp, err := loadClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %d", url, resp.StatusCode)
+	}
+
+	return decodeLoads(resp.Body)
+}
+
+func decodeLoads(r io.Reader) (zone.Loads, error) {
+	loads := make(zone.Loads)
+
+	if err := json.NewDecoder(io.LimitReader(r, maxLoadFeedSize)).Decode(&loads); err != nil {
+		return nil, err
+	}
+
+	return loads, nil
+}
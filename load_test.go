@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rench1988/gslb-dns/zone"
+)
+
+const testLoads = `{"10.0.0.1": {"mbps": 900}, "10.0.0.2": {"mbps": 100, "conns": 10}}`
+
+var testLoadsWant = zone.Loads{
+	"10.0.0.1": {"mbps": 900},
+	"10.0.0.2": {"mbps": 100, "conns": 10},
+}
+
+func TestDecodeLoads(t *testing.T) {
+	loads, err := decodeLoads(strings.NewReader(testLoads))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loads, testLoadsWant) {
+		t.Errorf("got %v, want %v", loads, testLoadsWant)
+	}
+
+	for _, bad := range []string{``, `[]`, `{"10.0.0.1": 900}`, `{"10.0.0.1": {"mbps": "a lot"}}`} {
+		if _, err := decodeLoads(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestPullLoads(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/loads":
+			fmt.Fprint(w, testLoads)
+		case "/broken":
+			fmt.Fprint(w, `{"10.0.0.1":`)
+		default:
+			http.Error(w, "no feed here", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	feed := loadFeed{URL: srv.URL + "/loads"}
+	loads, err := feed.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loads, testLoadsWant) {
+		t.Errorf("got %v, want %v", loads, testLoadsWant)
+	}
+
+	for _, path := range []string{"/broken", "/error"} {
+		if _, err := pullLoads(srv.URL + path); err == nil {
+			t.Errorf("%s: no error", path)
+		}
+	}
+}
+
+func TestReadLoadsFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "loads.json")
+	if err := os.WriteFile(fn, []byte(testLoads), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// an old file is read all the same
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(fn, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := loadFeed{File: fn}
+
+	loads, err := feed.read()
+	if err != nil || !reflect.DeepEqual(loads, testLoadsWant) {
+		t.Fatalf("got %v, %v, want %v", loads, err, testLoadsWant)
+	}
+
+	// unchanged
+	if loads, err = feed.read(); loads != nil || err != nil {
+		t.Errorf("unchanged file read again: %v, %v", loads, err)
+	}
+
+	if err := os.WriteFile(fn, []byte(`{"10.0.0.1": {"mbps": 10}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if loads, err = feed.read(); err != nil || loads["10.0.0.1"]["mbps"] != 10 {
+		t.Errorf("changed file: %v, %v", loads, err)
+	}
+}
@@ -30,6 +30,7 @@ var (
 var (
 	flagconfigfile  = flag.String("configfile", "gslb-dns.json", "filename of config file (in 'config' directory)")
 	flagcheckconfig = flag.Bool("checkconfig", false, "check configuration and exit")
+	flagcheckformat = flag.String("checkformat", "text", "-checkconfig report format (text or json)")
 	//flagidentifier   = flag.String("identifier", "", "identifier (hostname, pop name or similar)")
 	flaginter        = flag.String("interface", "*", "set the listener address")
 	flagport         = flag.String("port", "53", "default port number")
@@ -123,31 +124,10 @@ func main() {
 	}
 
 	if *flagcheckconfig {
-		err := readConf(*flagconfigfile)
-		if err != nil {
-			log.Println("Errors reading config", err)
+		if !checkConfig(*flagconfigfile, *flagcheckformat) {
 			os.Exit(2)
 		}
 
-		zones := make(zone.Zones)
-		plats := make(zone.Plats)
-
-		zones.SetupGslbZone()
-
-		for k, p := range conf.Platforms {
-			_, err = zones.AddZoneInfo(k, p.Domains)
-			if err != nil {
-				log.Println("Errors reading zones", err)
-				os.Exit(2)
-			}
-
-			err = plats.AddPlatInfo(k, p.Nodes)
-			if err != nil {
-				log.Println("Errors reading nodes", err)
-				os.Exit(2)
-			}
-		}
-
 		return
 	}
 
@@ -211,19 +191,22 @@ func main() {
 
 	inter := getInterfaces()
 
-	Zones := zone.NewZones()
-	Plats := zone.NewPlats()
+	zone.SetupRootZone()
+	zone.SetupGslbZone()
 
-	Zones.SetupRootZone()
-	Zones.SetupGslbZone()
-
-	go platsReader(Plats)
-	go zonesReader(Zones)
+	go platsReader()
+	go zonesReader()
+	go targetsReader()
+	go loadsReader()
 
 	for _, host := range inter {
 		go zone.ListenAndServe(host)
 	}
 
+	if len(*flaghttp) > 0 {
+		go httpServer(*flaghttp)
+	}
+
 	terminate := make(chan os.Signal)
 	signal.Notify(terminate, os.Interrupt)
 
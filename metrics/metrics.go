@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/rench1988/gslb-dns/hc"
+	"github.com/rench1988/gslb-dns/log"
+)
+
+const namespace = "gslbdns"
+
+var (
+	queries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "queries_total",
+			Help:      "DNS queries answered.",
+		},
+		[]string{"zone", "qtype", "rcode", "area", "transport"},
+	)
+
+	answerSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "answer_size_bytes",
+			Help:      "Size of the DNS responses.",
+			Buckets:   []float64{64, 128, 256, 512, 1024, 1232, 2048, 4096},
+		},
+		[]string{"zone"},
+	)
+
+	latency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_duration_seconds",
+			Help:      "Time spent answering DNS queries.",
+			Buckets:   []float64{.00005, .0001, .00025, .0005, .001, .0025, .005, .01, .05},
+		},
+		[]string{"zone"},
+	)
+
+	reloads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "config_reloads_total",
+			Help:      "Reloads of zone, node and area files.",
+		},
+		[]string{"kind", "result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(queries, answerSize, latency, reloads)
+	prometheus.MustRegister(hcCollector{}, logCollector{})
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Query records one answered query. size is the size of the response
+// in bytes and area is empty unless the answer came from a platform.
+func Query(zone string, qtype uint16, rcode int, area string, transport string, size int, d time.Duration) {
+	queries.WithLabelValues(zone, dns.TypeToString[qtype], dns.RcodeToString[rcode], area, transport).Inc()
+	answerSize.WithLabelValues(zone).Observe(float64(size))
+	latency.WithLabelValues(zone).Observe(d.Seconds())
+}
+
+// Reload records a reload of a configuration file, kind is "zone",
+// "plat" or "area".
+func Reload(kind string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	reloads.WithLabelValues(kind, result).Inc()
+}
+
+var (
+	hcUpDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "hc", "up"),
+		"Whether the node passes its health check.",
+		[]string{"addr", "port", "type", "key"}, nil,
+	)
+	hcFailuresDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "hc", "consecutive_failures"),
+		"Consecutive failed health checks of the node.",
+		[]string{"addr", "port", "type", "key"}, nil,
+	)
+	hcLastChangeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "hc", "last_change_timestamp_seconds"),
+		"Time of the last health state change of the node.",
+		[]string{"addr", "port", "type", "key"}, nil,
+	)
+	hcRTTDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "hc", "rtt_seconds"),
+		"Smoothed duration of the successful health checks of the node.",
+		[]string{"addr", "port", "type", "key"}, nil,
+	)
+)
+
+// hcCollector reports the state of the hc scheduler at scrape time.
+type hcCollector struct{}
+
+func (hcCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hcUpDesc
+	ch <- hcFailuresDesc
+	ch <- hcLastChangeDesc
+	ch <- hcRTTDesc
+}
+
+func (hcCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, st := range hc.Std.Status() {
+		port := strconv.Itoa(st.Port)
+
+		up := 0.0
+		if st.Healthy {
+			up = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(hcUpDesc, prometheus.GaugeValue, up, st.Addr, port, st.Type, st.Key)
+		ch <- prometheus.MustNewConstMetric(hcFailuresDesc, prometheus.GaugeValue, float64(st.Failures), st.Addr, port, st.Type, st.Key)
+		if !st.LastChange.IsZero() {
+			ch <- prometheus.MustNewConstMetric(hcLastChangeDesc, prometheus.GaugeValue, float64(st.LastChange.Unix()), st.Addr, port, st.Type, st.Key)
+		}
+		if st.RTT > 0 {
+			ch <- prometheus.MustNewConstMetric(hcRTTDesc, prometheus.GaugeValue, st.RTT/1000, st.Addr, port, st.Type, st.Key)
+		}
+	}
+}
+
+var logLinesDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "log", "lines_total"),
+	"Log lines written by level.",
+	[]string{"level"}, nil,
+)
+
+var logLevels = []string{"debug", "info", "warn", "error", "panic", "fatal"}
+
+// logCollector exports the level counters of the standard logger.
+type logCollector struct{}
+
+func (logCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- logLinesDesc
+}
+
+func (logCollector) Collect(ch chan<- prometheus.Metric) {
+	for lvl, n := range log.Std.Stat() {
+		if lvl >= len(logLevels) {
+			break
+		}
+		ch <- prometheus.MustNewConstMetric(logLinesDesc, prometheus.CounterValue, float64(n), logLevels[lvl])
+	}
+}
@@ -19,6 +19,7 @@ type Entry struct {
 	Rcode      int
 	Answers    int
 	Targets    []string
+	Policy     string
 	LabelName  string
 	RemoteAddr string
 	ClientAddr string
@@ -0,0 +1,134 @@
+package targeting
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIP looks up areas in MaxMind GeoIP2/GeoLite2 databases. The city
+// database may also be a country database, then only country targets
+// are returned.
+type GeoIP struct {
+	city *maxminddb.Reader
+	asn  *maxminddb.Reader
+}
+
+type geoName struct {
+	IsoCode string            `maxminddb:"iso_code"`
+	Names   map[string]string `maxminddb:"names"`
+}
+
+type cityRecord struct {
+	Country      geoName   `maxminddb:"country"`
+	Subdivisions []geoName `maxminddb:"subdivisions"`
+	City         geoName   `maxminddb:"city"`
+}
+
+type asnRecord struct {
+	AutonomousSystemNumber uint `maxminddb:"autonomous_system_number"`
+}
+
+// OpenGeoIP opens the given databases, either file name may be empty.
+func OpenGeoIP(cityFile string, asnFile string) (*GeoIP, error) {
+	g := new(GeoIP)
+
+	var err error
+
+	if len(cityFile) > 0 {
+		if g.city, err = maxminddb.Open(cityFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(asnFile) > 0 {
+		if g.asn, err = maxminddb.Open(asnFile); err != nil {
+			g.Close()
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+func (g *GeoIP) Close() {
+	if g.city != nil {
+		g.city.Close()
+	}
+	if g.asn != nil {
+		g.asn.Close()
+	}
+}
+
+// GetTargets returns the area keys for ip, most specific first:
+// "as4134", "cn-hunan-changsha", "cn-hunan", "cn". netmask is the
+// longest prefix of the database networks that were looked up, found
+// or not.
+func (g *GeoIP) GetTargets(ip net.IP) (targets []string, netmask int) {
+	if g == nil || ip == nil {
+		return nil, 0
+	}
+
+	if g.asn != nil {
+		var rec asnRecord
+		network, ok, err := g.asn.LookupNetwork(ip, &rec)
+		if err == nil && ok && rec.AutonomousSystemNumber > 0 {
+			targets = append(targets, "as"+strconv.FormatUint(uint64(rec.AutonomousSystemNumber), 10))
+		}
+		if err == nil {
+			netmask = maxNetmask(netmask, network)
+		}
+	}
+
+	if g.city != nil {
+		var rec cityRecord
+		network, ok, err := g.city.LookupNetwork(ip, &rec)
+		if err == nil && ok && len(rec.Country.IsoCode) > 0 {
+			country := strings.ToLower(rec.Country.IsoCode)
+
+			var region string
+			if len(rec.Subdivisions) > 0 {
+				if name := areaName(rec.Subdivisions[0]); len(name) > 0 {
+					region = country + "-" + name
+				}
+			}
+
+			if name := areaName(rec.City); len(name) > 0 && len(region) > 0 {
+				targets = append(targets, region+"-"+name)
+			}
+			if len(region) > 0 {
+				targets = append(targets, region)
+			}
+			targets = append(targets, country)
+		}
+		if err == nil {
+			netmask = maxNetmask(netmask, network)
+		}
+	}
+
+	return targets, netmask
+}
+
+// areaName turns "Inner Mongolia" into "inner_mongolia".
+func areaName(n geoName) string {
+	name := n.Names["en"]
+	if len(name) == 0 {
+		return ""
+	}
+
+	return strings.Replace(strings.ToLower(name), " ", "_", -1)
+}
+
+func maxNetmask(netmask int, network *net.IPNet) int {
+	if network == nil {
+		return netmask
+	}
+
+	if ones, _ := network.Mask.Size(); ones > netmask {
+		return ones
+	}
+
+	return netmask
+}
@@ -0,0 +1,133 @@
+package targeting
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+func testName(iso string, en string) mmdbtype.Map {
+	m := mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String(en)}}
+	if len(iso) > 0 {
+		m["iso_code"] = mmdbtype.String(iso)
+	}
+
+	return m
+}
+
+// writeMMDB writes a small database with the given records to dir.
+func writeMMDB(t *testing.T, dir string, name string, dbType string, records map[string]mmdbtype.Map) string {
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: dbType, RecordSize: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for cidr, rec := range records {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = tree.Insert(network, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fn := filepath.Join(dir, name)
+	fh, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	if _, err = tree.WriteTo(fh); err != nil {
+		t.Fatal(err)
+	}
+
+	return fn
+}
+
+func TestGeoIPGetTargets(t *testing.T) {
+	dir := t.TempDir()
+
+	city := writeMMDB(t, dir, "city.mmdb", "GeoIP2-City", map[string]mmdbtype.Map{
+		"1.2.3.0/24": {
+			"country":      testName("CN", "China"),
+			"subdivisions": mmdbtype.Slice{testName("HN", "Hunan")},
+			"city":         testName("", "Changsha"),
+		},
+		"1.2.4.0/22": {
+			"country":      testName("CN", "China"),
+			"subdivisions": mmdbtype.Slice{testName("NM", "Inner Mongolia")},
+		},
+		"5.6.0.0/16": {
+			"country": testName("DE", "Germany"),
+		},
+		"2400:cb00::/32": {
+			"country": testName("US", "United States"),
+		},
+	})
+
+	asn := writeMMDB(t, dir, "asn.mmdb", "GeoLite2-ASN", map[string]mmdbtype.Map{
+		"1.2.0.0/16": {"autonomous_system_number": mmdbtype.Uint32(4134)},
+	})
+
+	g, err := OpenGeoIP(city, asn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	tests := []struct {
+		ip      string
+		targets []string
+		netmask int
+	}{
+		{"1.2.3.4", []string{"as4134", "cn-hunan-changsha", "cn-hunan", "cn"}, 24},
+		{"1.2.5.6", []string{"as4134", "cn-inner_mongolia", "cn"}, 22},
+		{"5.6.7.8", []string{"de"}, 16},
+		{"2400:cb00::1", []string{"us"}, 32},
+	}
+
+	for _, tt := range tests {
+		targets, netmask := g.GetTargets(net.ParseIP(tt.ip))
+		if !reflect.DeepEqual(targets, tt.targets) {
+			t.Errorf("GetTargets(%s) = %v, want %v", tt.ip, targets, tt.targets)
+		}
+		if netmask != tt.netmask {
+			t.Errorf("GetTargets(%s) netmask = %d, want %d", tt.ip, netmask, tt.netmask)
+		}
+	}
+
+	// not in either database, the netmask still says how far it held
+	targets, netmask := g.GetTargets(net.ParseIP("8.8.8.8"))
+	if len(targets) != 0 || netmask == 0 {
+		t.Errorf("GetTargets(8.8.8.8) = %v, %d, want no targets and a netmask", targets, netmask)
+	}
+}
+
+func TestGeoIPCityOnly(t *testing.T) {
+	city := writeMMDB(t, t.TempDir(), "country.mmdb", "GeoIP2-Country", map[string]mmdbtype.Map{
+		"5.6.0.0/16": {"country": testName("DE", "Germany")},
+	})
+
+	g, err := OpenGeoIP(city, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	targets, netmask := g.GetTargets(net.ParseIP("5.6.7.8"))
+	if !reflect.DeepEqual(targets, []string{"de"}) || netmask != 16 {
+		t.Errorf("GetTargets(5.6.7.8) = %v, %d, want [de], 16", targets, netmask)
+	}
+
+	var nilGeoIP *GeoIP
+	if targets, _ := nilGeoIP.GetTargets(net.ParseIP("5.6.7.8")); targets != nil {
+		t.Errorf("nil GeoIP returned %v", targets)
+	}
+}
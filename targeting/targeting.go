@@ -0,0 +1,154 @@
+package targeting
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+)
+
+// Table maps CIDR networks to area names. Lookups pick the entry with
+// the longest matching prefix. IPv4 networks are stored in the IPv4
+// mapped part of the IPv6 space so one binary trie holds both families.
+type Table struct {
+	root *trieNode
+	size int
+}
+
+type trieNode struct {
+	child [2]*trieNode
+	area  string
+	set   bool
+}
+
+func NewTable() *Table {
+	return &Table{root: new(trieNode)}
+}
+
+// LoadTable reads an area file, a JSON object of area name to a list
+// of CIDRs:
+//
+//	{"hunan": ["1.2.3.0/24", "2001:db8::/32"], "beijing": ["5.6.0.0/16"]}
+func LoadTable(fileName string) (*Table, error) {
+	fh, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var areas map[string][]string
+
+	decoder := json.NewDecoder(fh)
+	if err = decoder.Decode(&areas); err != nil {
+		return nil, err
+	}
+
+	t := NewTable()
+
+	for area, cidrs := range areas {
+		for _, cidr := range cidrs {
+			if err := t.Add(cidr, area); err != nil {
+				return nil, fmt.Errorf("area %s: %s", area, err)
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// Add inserts a CIDR for area. A bare address is treated as a host route.
+func (t *Table) Add(cidr string, area string) error {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return fmt.Errorf("invalid network %q", cidr)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			ip = v4
+		}
+		ipnet = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+	}
+
+	ip, bits := normalize(ipnet.IP)
+	ones, _ := ipnet.Mask.Size()
+	plen := ones + (128 - bits)
+
+	n := t.root
+	for i := 0; i < plen; i++ {
+		b := bit(ip, i)
+		if n.child[b] == nil {
+			n.child[b] = new(trieNode)
+		}
+		n = n.child[b]
+	}
+
+	if !n.set {
+		t.size++
+	}
+	n.area = area
+	n.set = true
+
+	return nil
+}
+
+// Lookup returns the area of the longest prefix containing ip. netmask
+// is the number of leading bits of ip, in its own address family, that
+// decided the result: every address sharing them gets the same answer,
+// whether or not a network matched.
+func (t *Table) Lookup(ip net.IP) (area string, netmask int, ok bool) {
+	if t == nil || ip == nil {
+		return "", 0, false
+	}
+
+	ip16, bits := normalize(ip)
+	offset := 128 - bits
+
+	n := t.root
+	depth := 0
+
+	for {
+		// shorter prefixes than the family offset belong to the other family
+		if n.set && depth >= offset {
+			area, ok = n.area, true
+		}
+		if depth == 128 {
+			break
+		}
+		b := bit(ip16, depth)
+		next := n.child[b]
+		if next == nil {
+			// the other branch holds longer prefixes, so this bit
+			// decided the answer as well
+			if n.child[1-b] != nil {
+				depth++
+			}
+			break
+		}
+		n = next
+		depth++
+	}
+
+	netmask = depth - offset
+	if netmask < 0 {
+		netmask = 0
+	}
+
+	return area, netmask, ok
+}
+
+// Len returns the number of networks in the table.
+func (t *Table) Len() int {
+	return t.size
+}
+
+func bit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+func normalize(ip net.IP) (net.IP, int) {
+	if v4 := ip.To4(); v4 != nil {
+		return v4.To16(), 32
+	}
+	return ip.To16(), 128
+}
@@ -0,0 +1,92 @@
+package targeting
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTableLookup(t *testing.T) {
+	table := NewTable()
+	for cidr, area := range map[string]string{
+		"10.0.0.0/8":      "a",
+		"10.1.0.0/16":     "b",
+		"10.1.2.3":        "c",
+		"2001:db8::/32":   "v6",
+		"2001:db8:1::/48": "v6-48",
+	} {
+		if err := table.Add(cidr, area); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if table.Len() != 5 {
+		t.Errorf("Len() = %d, want 5", table.Len())
+	}
+
+	tests := []struct {
+		ip      string
+		area    string
+		netmask int
+		ok      bool
+	}{
+		{"10.1.2.3", "c", 32, true},
+		// 10.1.2.4/30 all miss the host route
+		{"10.1.2.4", "b", 30, true},
+		{"10.1.200.1", "b", 17, true},
+		// 10.2.0.0/15 is off the path to 10.1.0.0/16
+		{"10.2.0.1", "a", 15, true},
+		{"11.0.0.1", "", 8, false},
+		{"192.168.1.1", "", 1, false},
+		{"2001:db8::1", "v6", 48, true},
+		{"2001:db8:1::1", "v6-48", 48, true},
+		{"2001:db9::1", "", 32, false},
+		{"::ffff:10.1.2.3", "c", 32, true},
+	}
+
+	for _, tt := range tests {
+		area, netmask, ok := table.Lookup(net.ParseIP(tt.ip))
+		if area != tt.area || netmask != tt.netmask || ok != tt.ok {
+			t.Errorf("Lookup(%s) = %q, %d, %v, want %q, %d, %v", tt.ip, area, netmask, ok, tt.area, tt.netmask, tt.ok)
+		}
+	}
+
+	// an IPv4 default route doesn't catch IPv6 addresses
+	table.Add("0.0.0.0/0", "v4-default")
+	if area, _, ok := table.Lookup(net.ParseIP("2400::1")); ok {
+		t.Errorf("Lookup(2400::1) = %q from the IPv4 default route", area)
+	}
+	if area, netmask, _ := table.Lookup(net.ParseIP("192.168.1.1")); area != "v4-default" || netmask != 1 {
+		t.Errorf("Lookup(192.168.1.1) = %q, %d, want v4-default, 1", area, netmask)
+	}
+
+	if _, _, ok := (*Table)(nil).Lookup(net.ParseIP("10.1.2.3")); ok {
+		t.Error("nil table found an area")
+	}
+}
+
+func TestLoadTable(t *testing.T) {
+	dir := t.TempDir()
+
+	fn := filepath.Join(dir, "areas.json")
+	if err := os.WriteFile(fn, []byte(`{"hunan": ["1.2.3.0/24", "2001:db8::/32"], "beijing": ["5.6.0.0/16"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := LoadTable(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if area, netmask, _ := table.Lookup(net.ParseIP("1.2.3.4")); area != "hunan" || netmask != 24 {
+		t.Errorf("Lookup(1.2.3.4) = %q, %d, want hunan, 24", area, netmask)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"hunan": ["1.2.3.0/33"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTable(bad); err == nil {
+		t.Error("invalid network accepted")
+	}
+}
@@ -3,13 +3,12 @@ package util
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"io/ioutil"
 	"strconv"
-
-	"github.com/rench1988/gslb-dns/log"
 )
 
-func ValueToBool(v interface{}) (rv bool) {
+func ValueToBool(v interface{}) (rv bool, err error) {
 	switch v.(type) {
 	case bool:
 		rv = v.(bool)
@@ -26,41 +25,38 @@ func ValueToBool(v interface{}) (rv bool) {
 			rv = true
 		}
 	default:
-		log.Println("Can't convert", v, "to bool")
-		panic("Can't convert value")
+		err = fmt.Errorf("can't convert %v to bool", v)
 	}
-	return rv
+	return rv, err
 
 }
 
-func ValueToString(v interface{}) (rv string) {
+func ValueToString(v interface{}) (rv string, err error) {
 	switch v.(type) {
 	case string:
 		rv = v.(string)
 	case float64:
 		rv = strconv.FormatFloat(v.(float64), 'f', -1, 64)
 	default:
-		log.Println("Can't convert", v, "to string")
-		panic("Can't convert value")
+		err = fmt.Errorf("can't convert %v to string", v)
 	}
-	return rv
+	return rv, err
 }
 
-func ValueToInt(v interface{}) (rv int) {
+func ValueToInt(v interface{}) (rv int, err error) {
 	switch v.(type) {
 	case string:
-		i, err := strconv.Atoi(v.(string))
-		if err != nil {
-			panic("Error converting weight to integer")
+		i, perr := strconv.Atoi(v.(string))
+		if perr != nil {
+			err = fmt.Errorf("invalid integer %q", v)
 		}
 		rv = i
 	case float64:
 		rv = int(v.(float64))
 	default:
-		log.Println("Can't convert", v, "to integer")
-		panic("Can't convert value")
+		err = fmt.Errorf("can't convert %v to integer", v)
 	}
-	return rv
+	return rv, err
 }
 
 func Sha256File(fn string) string {
@@ -0,0 +1,108 @@
+package zone
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rench1988/gslb-dns/log"
+	"github.com/rench1988/gslb-dns/targeting"
+)
+
+const defaultArea = "@"
+
+type Targets map[string]*targeting.Table
+
+// how long replaced GeoIP databases stay open for lookups still using
+// them
+const geoIPCloseDelay = 10 * time.Second
+
+var (
+	// the area tables queries are answered from, UpdateTargets swaps in
+	// the next generation
+	targetGen atomic.Pointer[Targets]
+
+	// writers build the next generation one at a time
+	tMutex sync.Mutex
+
+	geoIP atomic.Pointer[targeting.GeoIP]
+)
+
+// CurrentTargets returns the current area tables. They must not be
+// changed, use UpdateTargets.
+func CurrentTargets() Targets {
+	if p := targetGen.Load(); p != nil {
+		return *p
+	}
+
+	return nil
+}
+
+// UpdateTargets applies fn to a copy of the current area tables and
+// swaps the result in unless fn fails.
+func UpdateTargets(fn func(Targets) error) error {
+	tMutex.Lock()
+	defer tMutex.Unlock()
+
+	next := make(Targets)
+	for k, v := range CurrentTargets() {
+		next[k] = v
+	}
+
+	if err := fn(next); err != nil {
+		return err
+	}
+
+	targetGen.Store(&next)
+
+	return nil
+}
+
+func (ts Targets) AddTargetInfo(platName string, areaFile string) error {
+	table, err := targeting.LoadTable(areaFile)
+	if err != nil {
+		log.Printf("Failed to load area file '%s': %s\n", areaFile, err)
+		return err
+	}
+
+	ts[platName] = table
+
+	return nil
+}
+
+func (ts Targets) DeleteTargetInfo(platName string) {
+	delete(ts, platName)
+}
+
+// SetupGeoIP replaces the GeoIP databases used by GetTargets and closes
+// the previous ones once lookups in flight are done with them.
+func SetupGeoIP(g *targeting.GeoIP) {
+	if old := geoIP.Swap(g); old != nil {
+		time.AfterFunc(geoIPCloseDelay, func() {
+			old.Close()
+		})
+	}
+}
+
+// GetTargets returns the areas to try for ip, most specific first, and
+// the prefix length of ip that decided them. The platform area file is
+// consulted first, then the GeoIP databases.
+func (ts Targets) GetTargets(platName string, ip net.IP) ([]string, int) {
+	var targets []string
+
+	area, netmask, ok := ts[platName].Lookup(ip)
+	if ok {
+		targets = append(targets, area)
+	}
+
+	geoTargets, mask := geoIP.Load().GetTargets(ip)
+	targets = append(targets, geoTargets...)
+	if mask > netmask {
+		netmask = mask
+	}
+
+	targets = append(targets, defaultArea)
+
+	return targets, netmask
+}
@@ -0,0 +1,258 @@
+package zone
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Check looks for problems the parser can't see in a single record:
+// labels or tiers drawing from an unknown pool, CNAMEs next to other data,
+// addresses listed twice and alias/CNAME loops.
+func (z *Zone) Check(ps Plats) ParseErrors {
+	var errs ParseErrors
+
+	names := make([]string, 0, len(z.Labels))
+	for name := range z.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		label := z.Labels[name]
+		if _, ok := ps[label.Platform]; !ok && label.Platform != z.Platform {
+			errs.add(labelPath(name)+".pool", "unknown pool %q", label.Platform)
+		}
+		for i, tier := range label.Tiers {
+			if _, ok := ps[tier.Pool]; !ok {
+				errs.add(fmt.Sprintf("%s.tiers[%d].pool", labelPath(name), i), "unknown pool %q", tier.Pool)
+			}
+		}
+	}
+
+	for _, name := range names {
+		label := z.Labels[name]
+		path := labelPath(name)
+
+		if _, ok := label.Records[dns.TypeCNAME]; ok && len(label.Records) > 1 {
+			var other []string
+			for rtype := range label.Records {
+				if rtype != dns.TypeCNAME {
+					other = append(other, typeKey(rtype))
+				}
+			}
+			sort.Strings(other)
+			errs.add(path+".cname", "CNAME together with %s", strings.Join(other, ", "))
+		}
+
+		for _, rtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			seen := make(map[string]bool)
+			for _, r := range label.Records[rtype] {
+				var ip net.IP
+				switch rr := r.RR.(type) {
+				case *dns.A:
+					ip = rr.A
+				case *dns.AAAA:
+					ip = rr.AAAA
+				}
+				if seen[ip.String()] {
+					errs.add(path+"."+typeKey(rtype), "duplicate address %s", ip)
+				}
+				seen[ip.String()] = true
+			}
+		}
+	}
+
+	return append(errs, z.CheckLoops()...)
+}
+
+// CheckLoops looks for alias/CNAME loops, a zone with one isn't served.
+func (z *Zone) CheckLoops() ParseErrors {
+	var errs ParseErrors
+
+	names := make([]string, 0, len(z.Labels))
+	for name := range z.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// 0 not visited, 1 on the current path, 2 done
+	state := make(map[string]int)
+	var stack []string
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = 1
+		stack = append(stack, name)
+
+		for _, next := range z.aliasTargets(z.Labels[name]) {
+			switch state[next] {
+			case 0:
+				visit(next)
+			case 1:
+				i := len(stack) - 1
+				for stack[i] != next {
+					i--
+				}
+				loop := make([]string, 0, len(stack)-i+1)
+				for _, n := range append(stack[i:], next) {
+					if len(n) == 0 {
+						n = "@"
+					}
+					loop = append(loop, n)
+				}
+				errs.add(labelPath(next), "alias/CNAME loop %s", strings.Join(loop, " -> "))
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[name] = 2
+	}
+
+	for _, name := range names {
+		if state[name] == 0 {
+			visit(name)
+		}
+	}
+
+	return errs
+}
+
+// aliasTargets returns the labels of z that label points to with an
+// alias or a CNAME.
+func (z *Zone) aliasTargets(label *Label) []string {
+	var names []string
+
+	for _, r := range label.Records[dns.TypeMF] {
+		names = append(names, strings.ToLower(r.RR.(*dns.MF).Mf))
+	}
+
+	suffix := "." + z.Origin + "."
+	for _, r := range label.Records[dns.TypeCNAME] {
+		target := strings.ToLower(r.RR.(*dns.CNAME).Target)
+		switch {
+		case target == z.Origin+".":
+			names = append(names, "")
+		case strings.HasSuffix(target, suffix):
+			names = append(names, strings.TrimSuffix(target, suffix))
+		}
+	}
+
+	res := names[:0]
+	for _, name := range names {
+		if _, ok := z.Labels[name]; ok {
+			res = append(res, name)
+		}
+	}
+
+	return res
+}
+
+// Check looks for problems in the platform settings o, prefix is their
+// JSON path.
+func (o PlatOptions) Check(prefix string) ParseErrors {
+	var errs ParseErrors
+
+	if !ValidPolicy(o.Policy) {
+		errs.add(keyPath(prefix, "policy"), "unknown policy %q", o.Policy)
+	}
+	if o.Policy == PolicyFallbackCname && len(o.FallbackCname) == 0 {
+		errs.add(keyPath(prefix, "fallbackCname"), "required by the %s policy", PolicyFallbackCname)
+	}
+
+	if !ValidSelection(o.Selection) {
+		errs.add(keyPath(prefix, "selection"), "unknown selection %q", o.Selection)
+	}
+
+	if err := o.SlowStart.Validate(); err != nil {
+		errs.add(keyPath(prefix, "slowStart"), "%s", err)
+	}
+
+	return errs
+}
+
+// Check looks for problems in the areas of p: health checks that can't
+// be set up, addresses listed twice in an area, areas whose nodes have
+// no weight, unknown policies and fallback-cname without a CNAME.
+func (p *Plat) Check() ParseErrors {
+	var errs ParseErrors
+
+	names := make([]string, 0, len(p.Areas))
+	for name := range p.Areas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		area := p.Areas[name]
+
+		if !ValidPolicy(area.Policy) {
+			errs.add(keyPath(keyPath("", name), "policy"), "unknown policy %q", area.Policy)
+		}
+		if err := area.checkCname(p.Options); err != nil {
+			errs.add(keyPath(keyPath("", name), "fallback_cname"), "%s", err)
+		}
+
+		for _, f := range []struct {
+			key   string
+			nodes []*Node
+		}{{"A", area.IPV4nodes}, {"AAAA", area.IPV6nodes}} {
+			path := keyPath(keyPath("", name), f.key)
+
+			seen := make(map[string]bool)
+			sum := 0
+
+			for _, n := range f.nodes {
+				sum += n.Weight
+
+				if seen[n.Addr] {
+					errs.add(path, "duplicate address %s", n.Addr)
+				}
+				seen[n.Addr] = true
+
+				if n.Hc != nil {
+					if err := n.Hc.Validate(); err != nil {
+						errs.add(path, "%s: %s health check: %s", n.Addr, n.Hc.Type, err)
+					}
+				}
+			}
+
+			if len(f.nodes) > 0 && sum == 0 {
+				errs.add(path, "total weight is 0")
+			}
+		}
+	}
+
+	return errs
+}
+
+// checkCname returns an error when area has the fallback-cname policy,
+// its own or that of the platform with options o, and no CNAME.
+func (area *Area) checkCname(o PlatOptions) error {
+	policy := area.Policy
+	if len(policy) == 0 {
+		policy = o.Policy
+	}
+
+	if policy == PolicyFallbackCname && len(area.FallbackCname) == 0 && len(o.FallbackCname) == 0 {
+		return fmt.Errorf("required by the %s policy", PolicyFallbackCname)
+	}
+
+	return nil
+}
+
+// typeKey is the name of rtype in a domain file.
+func typeKey(rtype uint16) string {
+	if rtype == dns.TypeMF {
+		return "alias"
+	}
+
+	if s, ok := dns.TypeToString[rtype]; ok {
+		return strings.ToLower(s)
+	}
+
+	return fmt.Sprintf("type%d", rtype)
+}
@@ -0,0 +1,50 @@
+package zone
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError is a problem in a domain file, Path is the JSON path of the
+// value, e.g. data.www.a[2].
+type ParseError struct {
+	Path string `json:"path"`
+	Msg  string `json:"error"`
+}
+
+func (e *ParseError) Error() string {
+	return e.Path + ": " + e.Msg
+}
+
+// ParseErrors are all the problems found in a domain file.
+type ParseErrors []*ParseError
+
+func (errs ParseErrors) Error() string {
+	s := make([]string, len(errs))
+	for i, e := range errs {
+		s[i] = e.Error()
+	}
+
+	return strings.Join(s, "; ")
+}
+
+func (errs *ParseErrors) add(path string, format string, a ...interface{}) {
+	*errs = append(*errs, &ParseError{Path: path, Msg: fmt.Sprintf(format, a...)})
+}
+
+// keyPath is the JSON path of key in the object at prefix.
+func keyPath(prefix string, key string) string {
+	switch {
+	case len(key) == 0 || strings.ContainsAny(key, ".[]"):
+		return fmt.Sprintf("%s[%q]", prefix, key)
+	case len(prefix) == 0:
+		return key
+	}
+
+	return prefix + "." + key
+}
+
+// labelPath is the JSON path of a label in the data section.
+func labelPath(label string) string {
+	return keyPath("data", label)
+}
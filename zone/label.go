@@ -13,16 +13,28 @@ type Record struct {
 }
 
 type Label struct {
-	Label    string
-	MaxHosts int
-	Ttl      int
-	Platform string
-	Records  map[uint16]Records
-	Weight   map[uint16]int
+	Label     string
+	MaxHosts  int
+	Ttl       int
+	Platform  string
+	Selection string
+	Tiers     []Tier
+	Records   map[uint16]Records
+	Weight    map[uint16]int
+
+	rings map[uint16]*ring // weighted records for consistent-hash
 }
 
 type labels map[string]*Label
 
+// Tier is a pool of nodes a label answers from while it has enough
+// healthy capacity, the next tier is tried otherwise.
+type Tier struct {
+	Pool       string
+	MinHealthy int // nodes
+	MinPercent int // of the weight
+}
+
 type Records []Record
 
 func (s Records) Len() int      { return len(s) }
@@ -36,13 +48,16 @@ func (l *Label) firstRR(dnsType uint16) dns.RR {
 	return l.Records[dnsType][0].RR
 }
 
-func (label *Label) Picker(qtype uint16, max int, area string) Records {
+// Picker returns up to max records of qtype for client. Addresses
+// without static records come from the label's platform nodes, or its
+// tiers, and how they were selected is returned with them.
+func (label *Label) Picker(qtype uint16, max int, client net.IP) (Records, Selection) {
 
 	if qtype == dns.TypeANY {
 		var result []Record
 		for rtype := range label.Records {
 
-			rtypeRecords := label.Picker(rtype, max, area)
+			rtypeRecords, _ := label.Picker(rtype, max, client)
 
 			tmpResult := make(Records, len(result)+len(rtypeRecords))
 
@@ -51,14 +66,14 @@ func (label *Label) Picker(qtype uint16, max int, area string) Records {
 			result = tmpResult
 		}
 
-		return result
+		return result, Selection{}
 	}
 
 	if labelRR := label.Records[qtype]; labelRR != nil {
 
 		// not "balanced", just return all
 		if label.Weight[qtype] == 0 {
-			return labelRR
+			return labelRR, Selection{}
 		}
 
 		if qtype == dns.TypeCNAME || qtype == dns.TypeMF {
@@ -70,6 +85,16 @@ func (label *Label) Picker(qtype uint16, max int, area string) Records {
 			max = rrCount
 		}
 
+		if r := label.rings[qtype]; r != nil && label.Selection == SelectionConsistentHash {
+			result := make([]Record, 0, max)
+			r.walk(clientKey(client), func(i int) bool {
+				result = append(result, labelRR[i])
+				return len(result) < max
+			})
+
+			return result, Selection{Hashed: true}
+		}
+
 		servers := make([]Record, len(labelRR))
 		copy(servers, labelRR)
 		result := make([]Record, max)
@@ -92,22 +117,31 @@ func (label *Label) Picker(qtype uint16, max int, area string) Records {
 			}
 		}
 
-		return result
+		return result, Selection{}
 	}
 
 	if qtype == dns.TypeA || qtype == dns.TypeAAAA {
-		ps := NewPlats()
-
-		res := ps.SearchPlatNode(label.Platform, area, qtype, max)
-		if len(res) == 0 {
-			return nil
-		}
+		res, sel := label.searchNodes(Query{
+			Qtype:     qtype,
+			Max:       max,
+			Selection: label.Selection,
+			Client:    client,
+		})
 
 		var h dns.RR_Header
 		h.Class = dns.ClassINET
 		h.Rrtype = qtype
 		h.Name = label.Label + "." + label.Platform + "."
 
+		if len(sel.Cname) > 0 {
+			h.Rrtype = dns.TypeCNAME
+			return Records{{RR: &dns.CNAME{Hdr: h, Target: dns.Fqdn(sel.Cname)}}}, sel
+		}
+
+		if len(res) == 0 {
+			return nil, sel
+		}
+
 		//result := make([]Record, len(res))
 		var result []Record
 
@@ -131,8 +165,77 @@ func (label *Label) Picker(qtype uint16, max int, area string) Records {
 			}
 		}
 
-		return result
+		return result, sel
+	}
+
+	return nil, Selection{}
+}
+
+// searchNodes picks the nodes of the label's platform for q, or of the
+// first tier with enough healthy capacity. When no tier has, the first
+// one with any healthy node answers and then the last one's policy
+// decides.
+func (label *Label) searchNodes(q Query) ([]string, Selection) {
+	ps, ts := CurrentPlats(), CurrentTargets()
+
+	if len(label.Tiers) == 0 {
+		//根据ip在label所属平台寻找对应区域
+		areas, netmask := ts.GetTargets(label.Platform, q.Client)
+
+		res, sel := ps.SearchPlatNode(label.Platform, areas, q)
+		sel.Targets, sel.Netmask = areas, netmask
+
+		return res, sel
 	}
 
-	return nil
+	// without an answer the scope is that of the tier that looked at
+	// the most of the client address
+	var none Selection
+
+	for _, withCapacity := range []bool{true, false} {
+		for i, tier := range label.Tiers {
+			areas, netmask := ts.GetTargets(tier.Pool, q.Client)
+			if ps.IsTargeted(tier.Pool) && netmask > none.Netmask {
+				none = Selection{Platform: tier.Pool, Targets: areas, Netmask: netmask}
+			}
+
+			tq := q
+			tq.tier = withCapacity || i < len(label.Tiers)-1
+			if withCapacity {
+				tq.MinHealthy, tq.MinPercent = tier.MinHealthy, tier.MinPercent
+			}
+
+			res, sel := ps.SearchPlatNode(tier.Pool, areas, tq)
+			if len(res) > 0 || len(sel.Policy) > 0 {
+				sel.Targets, sel.Netmask = areas, netmask
+				return res, sel
+			}
+		}
+	}
+
+	if len(none.Platform) == 0 {
+		none.Platform = label.Tiers[0].Pool
+	}
+
+	return nil, none
+}
+
+// prepareRings puts the weighted records of label on rings.
+func (label *Label) prepareRings() {
+	label.rings = make(map[uint16]*ring)
+
+	for rtype, records := range label.Records {
+		if label.Weight[rtype] == 0 {
+			continue
+		}
+
+		names := make([]string, len(records))
+		weights := make([]int, len(records))
+		for i, r := range records {
+			names[i] = ringKey(r)
+			weights[i] = r.Weight
+		}
+
+		label.rings[rtype] = newRing(names, weights)
+	}
 }
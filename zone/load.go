@@ -0,0 +1,66 @@
+package zone
+
+import (
+	"sync/atomic"
+)
+
+// Loads is the current load of each node by address, per metric in the
+// unit of the node capacity, e.g. {"10.0.0.1": {"mbps": 800}}.
+type Loads map[string]map[string]float64
+
+// the loads from the feed, nil when there's none or it's gone stale
+var loadGen atomic.Pointer[Loads]
+
+// a node at or over capacity still gets this much of its weight, so a
+// full area keeps answering
+const minLoadFactor = 0.01
+
+// SetLoads swaps in the loads of the nodes, nil stops load weighting.
+func SetLoads(loads Loads) {
+	if loads == nil {
+		loadGen.Store(nil)
+		return
+	}
+
+	loadGen.Store(&loads)
+}
+
+// CurrentLoads returns the loads from the feed, nil without any.
+func CurrentLoads() Loads {
+	if l := loadGen.Load(); l != nil {
+		return *l
+	}
+
+	return nil
+}
+
+// loadFactor is what the load of n leaves of its capacity, from the
+// busiest of its metrics. It's 1 without a capacity or a load.
+func (n *Node) loadFactor(loads Loads) float64 {
+	if len(n.Capacity) == 0 || loads == nil {
+		return 1
+	}
+
+	load := loads[n.Addr]
+	if load == nil {
+		return 1
+	}
+
+	factor := 1.0
+	for metric, capacity := range n.Capacity {
+		used, ok := load[metric]
+		if !ok || capacity <= 0 {
+			continue
+		}
+
+		if f := 1 - used/capacity; f < factor {
+			factor = f
+		}
+	}
+
+	if factor < minLoadFactor {
+		return minLoadFactor
+	}
+
+	return factor
+}
@@ -0,0 +1,79 @@
+package zone
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLoadFactor(t *testing.T) {
+	loads := Loads{
+		"10.0.0.1": {"mbps": 900},
+		"10.0.0.2": {"mbps": 100, "conns": 15},
+		"10.0.0.3": {"mbps": 2000},
+		"10.0.0.4": {"other": 5},
+	}
+
+	capacity := map[string]float64{"mbps": 1000, "conns": 20}
+
+	tests := []struct {
+		node  Node
+		loads Loads
+		want  float64
+	}{
+		{Node{Addr: "10.0.0.1", Capacity: capacity}, loads, 0.1},
+		// the busiest metric counts
+		{Node{Addr: "10.0.0.2", Capacity: capacity}, loads, 0.25},
+		// over capacity keeps a little
+		{Node{Addr: "10.0.0.3", Capacity: capacity}, loads, minLoadFactor},
+		// no metric in common
+		{Node{Addr: "10.0.0.4", Capacity: capacity}, loads, 1},
+		// not in the feed
+		{Node{Addr: "10.0.0.5", Capacity: capacity}, loads, 1},
+		// no capacity
+		{Node{Addr: "10.0.0.1"}, loads, 1},
+		// no feed
+		{Node{Addr: "10.0.0.1", Capacity: capacity}, nil, 1},
+	}
+
+	for _, tt := range tests {
+		if got := tt.node.loadFactor(tt.loads); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: loadFactor = %v, want %v", tt.node.Addr, got, tt.want)
+		}
+	}
+}
+
+func TestLoadWeights(t *testing.T) {
+	capacity := map[string]float64{"mbps": 1000}
+	p := newPicker([]*Node{
+		{Addr: "10.0.0.1", Weight: 1, Capacity: capacity},
+		{Addr: "10.0.0.2", Weight: 1, Capacity: capacity},
+		{Addr: "10.0.0.3", Weight: 1},
+	}, nil)
+
+	defer SetLoads(nil)
+
+	SetLoads(nil)
+	if w := p.effectiveWeights(Query{}); w != nil {
+		t.Errorf("weights without loads: %v", w)
+	}
+
+	SetLoads(Loads{"10.0.0.1": {"mbps": 900}, "10.0.0.2": {"mbps": 500}})
+	want := []float64{0.1, 0.5, 1}
+	w := p.effectiveWeights(Query{})
+	for i := range want {
+		if len(w) != len(want) || math.Abs(w[i]-want[i]) > 1e-9 {
+			t.Fatalf("weights = %v, want %v", w, want)
+		}
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 16000; i++ {
+		counts[p.pick(Query{Max: 1}, true)[0]]++
+	}
+	for i, addr := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		expected := 16000 * want[i] / 1.6
+		if math.Abs(float64(counts[addr])-expected) > 0.1*expected+50 {
+			t.Errorf("%s picked %d times, expected about %.0f", addr, counts[addr], expected)
+		}
+	}
+}
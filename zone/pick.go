@@ -0,0 +1,429 @@
+package zone
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// Query is what SearchPlatNode picks nodes for.
+type Query struct {
+	Qtype     uint16
+	Max       int
+	Selection string // the platform's selection mode when empty
+	Client    net.IP // ECS or resolver address
+
+	// for a tier, the healthy nodes and percentage of the weight an
+	// area needs to answer
+	MinHealthy int
+	MinPercent int
+
+	key       uint64    // ring key of Client for consistent-hash
+	tier      bool      // no failure policy
+	slowStart SlowStart // of the platform
+}
+
+// picker draws nodes in proportion to their weight with an alias table
+// (Vose), so a draw is O(1) however many nodes there are, or walks a
+// consistent hash ring of them. It's built by prepare for each
+// generation of an area and never changed after.
+type picker struct {
+	nodes []*Node
+	sum   int
+	prob  []float64
+	alias []int
+
+	// the ring is only built when consistent-hash uses it
+	ring     *ring
+	ringOnce sync.Once
+
+	// weights that change: the schedule of the area, whether some
+	// node has a capacity or a schedule
+	schedule  Schedule
+	loaded    bool
+	scheduled bool
+}
+
+// the pickers of an area for one address family
+type familyPickers struct {
+	active  *picker
+	drained *picker
+}
+
+func newPicker(nodes []*Node, schedule Schedule) *picker {
+	p := &picker{nodes: nodes, schedule: schedule, scheduled: len(schedule) > 0}
+
+	for _, n := range nodes {
+		if n.Weight > 0 {
+			p.sum += n.Weight
+		}
+		if len(n.Capacity) > 0 {
+			p.loaded = true
+		}
+		if len(n.Schedule) > 0 {
+			p.scheduled = true
+		}
+	}
+
+	if p.sum == 0 {
+		return p
+	}
+
+	count := len(nodes)
+	p.prob = make([]float64, count)
+	p.alias = make([]int, count)
+
+	scaled := make([]float64, count)
+	var small, large []int
+
+	for i, n := range nodes {
+		if n.Weight > 0 {
+			scaled[i] = float64(n.Weight) * float64(count) / float64(p.sum)
+		}
+		if scaled[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+
+	for len(small) > 0 && len(large) > 0 {
+		s, l := small[len(small)-1], large[len(large)-1]
+		small = small[:len(small)-1]
+
+		p.prob[s] = scaled[s]
+		p.alias[s] = l
+
+		scaled[l] -= 1 - scaled[s]
+		if scaled[l] < 1 {
+			large = large[:len(large)-1]
+			small = append(small, l)
+		}
+	}
+
+	// what's left is 1 up to rounding errors
+	for _, i := range append(small, large...) {
+		p.prob[i] = 1
+		p.alias[i] = i
+	}
+
+	return p
+}
+
+// getRing returns the consistent hash ring of the nodes of p.
+func (p *picker) getRing() *ring {
+	p.ringOnce.Do(func() {
+		names := make([]string, len(p.nodes))
+		weights := make([]int, len(p.nodes))
+		for i, n := range p.nodes {
+			names[i] = n.Addr
+			weights[i] = n.Weight
+		}
+		p.ring = newRing(names, weights)
+	})
+
+	return p.ring
+}
+
+func (p *picker) draw() int {
+	i := rand.Intn(len(p.nodes))
+	if rand.Float64() < p.prob[i] {
+		return i
+	}
+
+	return p.alias[i]
+}
+
+// pick returns up to max nodes drawn by weight without repeats, or the
+// first ones on the ring from the client key for consistent-hash. The
+// weights follow the schedules, are lowered by the load of nodes with a
+// capacity and while nodes ramp up, and for fastest are scaled by their
+// inverse RTT. The ring keeps the configured weights. Nodes that aren't
+// healthy are passed over and don't take a place, unless healthyOnly is
+// false. When no node has a weight all of them are returned, nodes
+// without weight are never picked otherwise.
+func (p *picker) pick(q Query, healthyOnly bool) []string {
+	if p == nil || len(p.nodes) == 0 {
+		return nil
+	}
+
+	max := q.Max
+
+	// the state of the nodes for this query only
+	const (
+		unseen = iota
+		taken
+		skipped
+	)
+	state := make([]uint8, len(p.nodes))
+
+	usable := func(i int) bool {
+		return !healthyOnly || p.nodes[i].healthy()
+	}
+
+	var res []string
+
+	if p.sum == 0 {
+		for i, n := range p.nodes {
+			if usable(i) {
+				res = append(res, n.Addr)
+			}
+		}
+
+		return res
+	}
+
+	if q.Selection == SelectionFastest {
+		return p.drawBy(p.fastestWeights(p.effectiveWeights(q)), max, usable)
+	}
+
+	if q.Selection != SelectionConsistentHash {
+		if weights := p.effectiveWeights(q); weights != nil {
+			return p.drawBy(weights, max, usable)
+		}
+	}
+
+	if q.Selection == SelectionConsistentHash {
+		if max <= 0 {
+			return nil
+		}
+
+		p.getRing().walk(q.key, func(i int) bool {
+			if usable(i) {
+				res = append(res, p.nodes[i].Addr)
+			}
+			return len(res) < max
+		})
+
+		return res
+	}
+
+	// draw from the table while it mostly hits nodes not looked at yet
+	for misses := 0; len(res) < max && misses < 2*max+4; {
+		i := p.draw()
+		if state[i] != unseen {
+			misses++
+			continue
+		}
+
+		if usable(i) {
+			state[i] = taken
+			res = append(res, p.nodes[i].Addr)
+		} else {
+			state[i] = skipped
+		}
+	}
+
+	if len(res) == max {
+		return res
+	}
+
+	// then go through what's left, so there are always max nodes if
+	// that many can be used
+	var rest []int
+	sum := 0
+
+	for i, n := range p.nodes {
+		if state[i] == unseen && n.Weight > 0 && usable(i) {
+			rest = append(rest, i)
+			sum += n.Weight
+		}
+	}
+
+	for len(res) < max && len(rest) > 0 {
+		r := rand.Intn(sum)
+
+		for j, i := range rest {
+			r -= p.nodes[i].Weight
+			if r < 0 {
+				res = append(res, p.nodes[i].Addr)
+				sum -= p.nodes[i].Weight
+				rest = append(rest[:j:j], rest[j+1:]...)
+				break
+			}
+		}
+	}
+
+	return res
+}
+
+// fastestWeights are weights, the configured ones when nil, divided by
+// the smoothed RTT of the nodes. A node without one yet counts as the
+// mean of the others, with no RTT at all the weights are unchanged.
+func (p *picker) fastestWeights(weights []float64) []float64 {
+	if weights == nil {
+		weights = make([]float64, len(p.nodes))
+		for i, n := range p.nodes {
+			if n.Weight > 0 {
+				weights[i] = float64(n.Weight)
+			}
+		}
+	}
+
+	rtts := make([]float64, len(p.nodes))
+	total, known := 0.0, 0
+
+	for i, n := range p.nodes {
+		if n.Weight <= 0 {
+			continue
+		}
+		if rtt, ok := n.rtt(); ok {
+			rtts[i] = rtt.Seconds()
+			total += rtts[i]
+			known++
+		}
+	}
+
+	if known == 0 {
+		return weights
+	}
+
+	for i, n := range p.nodes {
+		if n.Weight <= 0 {
+			continue
+		}
+
+		rtt := rtts[i]
+		if rtt == 0 {
+			rtt = total / float64(known)
+		}
+		weights[i] /= rtt
+	}
+
+	return weights
+}
+
+// drawBy returns up to max usable nodes drawn by weights without
+// repeats, it's O(n) for each node so only for weights that change
+// between queries.
+func (p *picker) drawBy(weights []float64, max int, usable func(i int) bool) []string {
+	var rest []int
+	sum := 0.0
+
+	for i, w := range weights {
+		if w > 0 && usable(i) {
+			rest = append(rest, i)
+			sum += w
+		}
+	}
+
+	var res []string
+
+	for len(res) < max && len(rest) > 0 {
+		r := rand.Float64() * sum
+
+		// the last one when rounding leaves something of r
+		j := len(rest) - 1
+		for k, i := range rest {
+			r -= weights[i]
+			if r < 0 {
+				j = k
+				break
+			}
+		}
+
+		i := rest[j]
+		res = append(res, p.nodes[i].Addr)
+		sum -= weights[i]
+		rest = append(rest[:j:j], rest[j+1:]...)
+	}
+
+	return res
+}
+
+// pick returns up to q.Max nodes of the family of q.Qtype, skipping
+// unhealthy nodes unless healthyOnly is false. Drained nodes are only
+// used when no active node can be picked, nodes in maintenance never.
+// With a tier minimum the area answers only when enough of its active
+// nodes are healthy.
+func (area *Area) pick(q Query, healthyOnly bool) []string {
+	if healthyOnly {
+		if res := area.pickFrom(q, false); len(res) > 0 {
+			return res
+		}
+		return area.pickFrom(q, true)
+	}
+
+	fp := area.family(q.Qtype)
+	if res := fp.active.pick(q, false); len(res) > 0 {
+		return res
+	}
+
+	return fp.drained.pick(q, false)
+}
+
+// pickFrom returns up to q.Max healthy nodes of the family of q.Qtype
+// from the active nodes of area, or from its drained ones. With a tier
+// minimum only enough healthy active nodes answer, drained ones never.
+func (area *Area) pickFrom(q Query, drained bool) []string {
+	fp := area.family(q.Qtype)
+
+	if q.MinHealthy > 0 || q.MinPercent > 0 {
+		if drained || !fp.active.enough(q.MinHealthy, q.MinPercent) {
+			return nil
+		}
+		return fp.active.pick(q, true)
+	}
+
+	if drained {
+		return fp.drained.pick(q, true)
+	}
+
+	return fp.active.pick(q, true)
+}
+
+func (area *Area) family(qtype uint16) familyPickers {
+	if qtype != dns.TypeA {
+		return area.pickers[1]
+	}
+
+	return area.pickers[0]
+}
+
+// enough reports whether at least min nodes and percent of the weight
+// of p are healthy.
+func (p *picker) enough(min int, percent int) bool {
+	if p == nil {
+		return false
+	}
+
+	count, weight := 0, 0
+	for _, n := range p.nodes {
+		if n.healthy() {
+			count++
+			if n.Weight > 0 {
+				weight += n.Weight
+			}
+		}
+	}
+
+	if count == 0 || count < min {
+		return false
+	}
+
+	return weight*100 >= percent*p.sum
+}
+
+// preparePickers builds the pickers of area from its nodes.
+func (area *Area) preparePickers() {
+	for i, nodes := range [][]*Node{area.IPV4nodes, area.IPV6nodes} {
+		var active, drained []*Node
+
+		for _, n := range nodes {
+			switch n.State {
+			case StateMaintenance:
+			case StateDrain:
+				drained = append(drained, n)
+			default:
+				active = append(active, n)
+			}
+		}
+
+		area.pickers[i] = familyPickers{
+			active:  newPicker(active, area.Schedule),
+			drained: newPicker(drained, area.Schedule),
+		}
+	}
+}
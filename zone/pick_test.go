@@ -0,0 +1,242 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rench1988/gslb-dns/hc"
+)
+
+// the "down" check fails for every address
+type downChecker struct{}
+
+func (downChecker) Check(addr string) error { return errors.New("down") }
+
+func init() {
+	hc.Register("down", func(c *hc.Config) (hc.Checker, error) { return downChecker{}, nil })
+}
+
+// markDown registers failing checks for nodes and waits until the
+// scheduler has them down. The areas need to be prepared after.
+func markDown(t *testing.T, nodes ...*Node) {
+	for _, n := range nodes {
+		n.Hc = &hc.Config{Type: "down", Interval: 1, Fall: 1}
+		key, err := hc.Std.Add(n.Addr, n.Hc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { hc.Std.Del(key) })
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, n := range nodes {
+		for hc.Std.IsHealthy(n.Hc.Key(n.Addr)) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s not down", n.Addr)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+func testArea(weights ...int) *Area {
+	area := new(Area)
+	for i, w := range weights {
+		area.IPV4nodes = append(area.IPV4nodes, &Node{Addr: fmt.Sprintf("10.0.0.%d", i+1), Weight: w})
+	}
+
+	return area
+}
+
+func TestPickDistribution(t *testing.T) {
+	tests := []struct {
+		weights []int
+	}{
+		{[]int{1, 2, 7}},
+		{[]int{1, 1, 1, 1}},
+		{[]int{100, 1}},
+		{[]int{5, 0, 5}},
+	}
+
+	const draws = 50000
+
+	for _, tt := range tests {
+		area := testArea(tt.weights...)
+		Areas{"x": area}.prepare()
+
+		sum := 0
+		for _, w := range tt.weights {
+			sum += w
+		}
+
+		counts := make(map[string]int)
+		for i := 0; i < draws; i++ {
+			res := area.pick(Query{Qtype: dns.TypeA, Max: 1}, true)
+			if len(res) != 1 {
+				t.Fatalf("%v: got %v", tt.weights, res)
+			}
+			counts[res[0]]++
+		}
+
+		for i, w := range tt.weights {
+			addr := area.IPV4nodes[i].Addr
+			expected := float64(draws*w) / float64(sum)
+			if math.Abs(float64(counts[addr])-expected) > 0.05*expected+100 {
+				t.Errorf("%v: %s picked %d times, expected about %.0f", tt.weights, addr, counts[addr], expected)
+			}
+		}
+	}
+}
+
+func TestPickMax(t *testing.T) {
+	area := testArea(1, 2, 7, 1, 1, 0)
+	Areas{"x": area}.prepare()
+
+	for i := 0; i < 1000; i++ {
+		res := area.pick(Query{Qtype: dns.TypeA, Max: 3}, true)
+		if len(res) != 3 {
+			t.Fatalf("got %v, want 3 nodes", res)
+		}
+
+		seen := make(map[string]bool)
+		for _, addr := range res {
+			if seen[addr] {
+				t.Fatalf("%s picked twice in %v", addr, res)
+			}
+			if addr == "10.0.0.6" {
+				t.Fatalf("node without weight picked in %v", res)
+			}
+			seen[addr] = true
+		}
+	}
+
+	// more than there are nodes with a weight
+	if res := area.pick(Query{Qtype: dns.TypeA, Max: 10}, true); len(res) != 5 {
+		t.Errorf("got %v, want the 5 nodes with a weight", res)
+	}
+
+	// no weights at all, every node
+	none := testArea(0, 0, 0)
+	Areas{"x": none}.prepare()
+	if res := none.pick(Query{Qtype: dns.TypeA, Max: 1}, true); len(res) != 3 {
+		t.Errorf("got %v, want all nodes when none has a weight", res)
+	}
+}
+
+func TestPickSkipsUnhealthy(t *testing.T) {
+	// the heavy nodes are down, the table mostly draws them
+	area := testArea(50, 50, 50, 1, 1, 1)
+	markDown(t, area.IPV4nodes[:3]...)
+	Areas{"x": area}.prepare()
+
+	for i := 0; i < 1000; i++ {
+		res := area.pick(Query{Qtype: dns.TypeA, Max: 2}, true)
+		if len(res) != 2 {
+			t.Fatalf("got %v, want 2 healthy nodes", res)
+		}
+		for _, addr := range res {
+			if addr <= "10.0.0.3" {
+				t.Fatalf("unhealthy node picked in %v", res)
+			}
+		}
+	}
+
+	if res := area.pick(Query{Qtype: dns.TypeA, Max: 6}, true); len(res) != 3 {
+		t.Errorf("got %v, want the 3 healthy nodes", res)
+	}
+
+	// fail-open picks from all nodes
+	if res := area.pick(Query{Qtype: dns.TypeA, Max: 6}, false); len(res) != 6 {
+		t.Errorf("got %v, want all 6 nodes", res)
+	}
+}
+
+func TestPickDrained(t *testing.T) {
+	area := testArea(1, 1, 1)
+	area.IPV4nodes[1].State = StateDrain
+	area.IPV4nodes[2].State = StateMaintenance
+	Areas{"x": area}.prepare()
+
+	for i := 0; i < 100; i++ {
+		res := area.pick(Query{Qtype: dns.TypeA, Max: 3}, true)
+		if len(res) != 1 || res[0] != "10.0.0.1" {
+			t.Fatalf("got %v, want only the active node", res)
+		}
+	}
+
+	markDown(t, area.IPV4nodes[0])
+	Areas{"x": area}.prepare()
+	if res := area.pick(Query{Qtype: dns.TypeA, Max: 3}, true); len(res) != 1 || res[0] != "10.0.0.2" {
+		t.Errorf("got %v, want the drained node when the active one is down", res)
+	}
+}
+
+func TestDrawBy(t *testing.T) {
+	p := newPicker(testArea(1, 1, 1, 1).IPV4nodes, nil)
+	weights := []float64{1, 2, 7, 0}
+	all := func(int) bool { return true }
+
+	counts := make(map[string]int)
+	for i := 0; i < 50000; i++ {
+		res := p.drawBy(weights, 1, all)
+		if len(res) != 1 {
+			t.Fatalf("got %v", res)
+		}
+		counts[res[0]]++
+	}
+	for i, w := range weights {
+		addr := p.nodes[i].Addr
+		expected := 50000 * w / 10
+		if math.Abs(float64(counts[addr])-expected) > 0.05*expected+100 {
+			t.Errorf("%s picked %d times, expected about %.0f", addr, counts[addr], expected)
+		}
+	}
+
+	// without repeats, never the node without weight or an unusable one
+	for i := 0; i < 1000; i++ {
+		res := p.drawBy(weights, 4, func(i int) bool { return i != 1 })
+		if len(res) != 2 || res[0] == res[1] {
+			t.Fatalf("got %v, want 10.0.0.1 and 10.0.0.3", res)
+		}
+		for _, addr := range res {
+			if addr != "10.0.0.1" && addr != "10.0.0.3" {
+				t.Fatalf("got %v, want 10.0.0.1 and 10.0.0.3", res)
+			}
+		}
+	}
+}
+
+func TestSearchDrainedLast(t *testing.T) {
+	x := testArea(1, 1)
+	x.IPV4nodes[1].Addr = "10.0.1.2"
+	x.IPV4nodes[1].State = StateDrain
+	x.Fallback = []string{"@"}
+
+	def := testArea(1)
+	def.IPV4nodes[0].Addr = "10.0.2.1"
+
+	markDown(t, x.IPV4nodes[0])
+	areas := Areas{"x": x, "@": def}
+	areas.prepare()
+	ps := Plats{"p": &Plat{Areas: areas}}
+
+	q := Query{Qtype: dns.TypeA, Max: 1}
+
+	// the fallback has a healthy active node
+	res, sel := ps.SearchPlatNode("p", []string{"x"}, q)
+	if len(res) != 1 || res[0] != "10.0.2.1" || sel.Area != "@" {
+		t.Errorf("got %v from %q, want the node of the fallback", res, sel.Area)
+	}
+
+	// nothing active is healthy, the drained node answers
+	markDown(t, def.IPV4nodes[0])
+	areas.prepare()
+	res, sel = ps.SearchPlatNode("p", []string{"x"}, q)
+	if len(res) != 1 || res[0] != "10.0.1.2" || sel.Area != "x" {
+		t.Errorf("got %v from %q, want the drained node", res, sel.Area)
+	}
+}
@@ -3,57 +3,125 @@ package zone
 import (
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"os"
-	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/miekg/dns"
-
+	"github.com/rench1988/gslb-dns/hc"
 	"github.com/rench1988/gslb-dns/log"
 )
 
-type Plats map[string]Areas
+// node states, an empty state is active
+const (
+	StateActive      = "active"
+	StateDrain       = "drain"
+	StateMaintenance = "maintenance"
+)
+
+const (
+	PolicyFailClosed    = "fail-closed"
+	PolicyFailOpen      = "fail-open"
+	PolicyFallbackCname = "fallback-cname"
+)
+
+// ValidPolicy reports whether s is a failure policy, an empty one means
+// the platform's or fail-closed.
+func ValidPolicy(s string) bool {
+	switch s {
+	case "", PolicyFailClosed, PolicyFailOpen, PolicyFallbackCname:
+		return true
+	}
+
+	return false
+}
+
+type Plats map[string]*Plat
+
+type Plat struct {
+	Areas   Areas
+	Options PlatOptions
+	File    string // the node file the areas were read from
+}
+
+// PlatOptions are the platform settings from gslb-dns.json. Policy and
+// FallbackCname are the defaults for areas that don't set their own.
+type PlatOptions struct {
+	Policy        string    `json:"policy"`
+	FallbackCname string    `json:"fallbackCname"`
+	Selection     string    `json:"selection"`
+	SlowStart     SlowStart `json:"slowStart"`
+}
 
 type Areas map[string]*Area
 
 type Area struct {
-	IPV4nodes []*node `json:"A"`
-	IPV6nodes []*node `json:"AAAA"`
+	IPV4nodes     []*Node  `json:"A,omitempty"`
+	IPV6nodes     []*Node  `json:"AAAA,omitempty"`
+	Fallback      []string `json:"fallback,omitempty"`
+	Policy        string   `json:"policy,omitempty"`
+	FallbackCname string   `json:"fallback_cname,omitempty"`
+	Schedule      Schedule `json:"schedule,omitempty"`
 
-	Records map[uint16]Records
+	Records map[uint16]Records `json:"-"`
 
-	ipv4Weight int
-	ipv6Weight int
+	pickers [2]familyPickers // A and AAAA
 }
 
-type node struct {
-	Addr   string `json:"ip"`
-	Weight int    `json:"weight"`
-	Hc     *hc    `json:"hc"`
+type Node struct {
+	Addr   string     `json:"ip"`
+	Weight int        `json:"weight"`
+	Hc     *hc.Config `json:"hc,omitempty"`
+	State  string     `json:"state,omitempty"`
 
-	status int //down or up
-}
+	// what the node can take of each metric of the load feed
+	Capacity map[string]float64 `json:"capacity,omitempty"`
 
-type hc struct {
-	Type string `json:"type"`
-	Port int    `json:"port"`
+	// weights by the time of day or date
+	Schedule Schedule `json:"schedule,omitempty"`
+
+	since time.Time // when it came into service, for slow start
+	hcKey string    // of Hc, set by prepare
 }
 
 var (
-	ponce sync.Once
-
-	ps Plats
+	// the platforms queries are answered from, UpdatePlats swaps in the
+	// next generation
+	platGen atomic.Pointer[Plats]
 
-	pMutex sync.RWMutex
+	// writers build the next generation one at a time
+	pMutex sync.Mutex
 )
 
-func NewPlats() Plats {
-	ponce.Do(func() {
-		ps = make(Plats)
-	})
+// CurrentPlats returns the current platforms. They must not be changed,
+// use UpdatePlats.
+func CurrentPlats() Plats {
+	if p := platGen.Load(); p != nil {
+		return *p
+	}
+
+	return nil
+}
+
+// UpdatePlats applies fn to a copy of the current platforms and swaps
+// the result in unless fn fails. A Plat is never changed once it's in a
+// generation, fn replaces it instead.
+func UpdatePlats(fn func(Plats) error) error {
+	pMutex.Lock()
+	defer pMutex.Unlock()
+
+	next := make(Plats)
+	for k, v := range CurrentPlats() {
+		next[k] = v
+	}
+
+	if err := fn(next); err != nil {
+		return err
+	}
+
+	platGen.Store(&next)
 
-	return ps
+	return nil
 }
 
 func (ps Plats) AddPlatInfo(platName string, platFile string) error {
@@ -62,181 +130,267 @@ func (ps Plats) AddPlatInfo(platName string, platFile string) error {
 		log.Printf("Failed to open nodes file: %s\n", err)
 		return err
 	}
+	defer file.Close()
 
 	areas := make(Areas)
 
 	decoder := json.NewDecoder(file)
 
-	err = decoder.Decode(areas)
+	err = decoder.Decode(&areas)
 	if err != nil {
 		log.Printf("Failed to parse config data: %s\n", err)
 		return err
 	}
 
-	for _, area := range areas {
-		/*
-			area.Records = make(map[uint16]Records)
-
-			area.Records[dns.TypeA] = make(Records, len(area.IPV4nodes))
-			area.Records[dns.TypeAAAA] = make(Records, len(area.IPV6nodes))
-		*/
-		for _, v4node := range area.IPV4nodes {
-			area.ipv4Weight += v4node.Weight
+	for areaName, area := range areas {
+		if !ValidPolicy(area.Policy) {
+			log.Printf("Bad policy %q in area %s\n", area.Policy, areaName)
+			return fmt.Errorf("%w: unknown policy %q in %s", ErrBadArea, area.Policy, areaName)
 		}
-		for _, v6node := range area.IPV6nodes {
-			area.ipv6Weight += v6node.Weight
+
+		for _, nodes := range [][]*Node{area.IPV4nodes, area.IPV6nodes} {
+			for _, n := range nodes {
+				if err := n.validate(); err != nil {
+					log.Printf("Bad node %s in area %s: %s\n", n.Addr, areaName, err)
+					return err
+				}
+			}
 		}
+	}
 
-		sort.Slice(area.IPV4nodes, func(i, j int) bool { return area.IPV4nodes[i].Weight > area.IPV4nodes[j].Weight })
-		sort.Slice(area.IPV6nodes, func(i, j int) bool { return area.IPV6nodes[i].Weight > area.IPV6nodes[j].Weight })
+	if p, ok := ps[platName]; ok {
+		areas.carrySince(p.Areas, time.Now())
 	}
 
-	pMutex.Lock()
-	ps[platName] = areas
-	pMutex.Unlock()
+	areas.prepare()
+
+	if p, ok := ps[platName]; ok {
+		ps[platName] = &Plat{Areas: areas, Options: p.Options, File: platFile}
+	} else {
+		ps[platName] = &Plat{Areas: areas, File: platFile}
+	}
+
+	return nil
+}
+
+// prepare builds the pickers of a new generation of areas and the keys
+// of the health checks of their nodes.
+func (areas Areas) prepare() {
+	for _, area := range areas {
+		for _, nodes := range [][]*Node{area.IPV4nodes, area.IPV6nodes} {
+			for _, n := range nodes {
+				if n.Hc != nil {
+					n.hcKey = n.Hc.Key(n.Addr)
+				}
+			}
+		}
+		area.preparePickers()
+	}
+}
+
+// SetPlatOptions updates the settings of a loaded platform, invalid
+// ones are returned as an error and the platform keeps its settings.
+func (ps Plats) SetPlatOptions(platName string, opts PlatOptions) error {
+	p, ok := ps[platName]
+	if !ok || p.Options == opts {
+		return nil
+	}
+
+	if errs := opts.Check(""); len(errs) > 0 {
+		return errs
+	}
+
+	ps[platName] = &Plat{Areas: p.Areas, Options: opts, File: p.File}
 
 	return nil
 }
 
 func (ps Plats) DeletePlatInfo(platName string) {
-	pMutex.Lock()
 	delete(ps, platName)
-	pMutex.Unlock()
 }
 
 func (ps Plats) GetPlatAreaInfo(platName string, areaName string) *Area {
-	pMutex.RLock()
-	defer pMutex.RUnlock()
 	p := ps[platName]
 	if p == nil {
 		return nil
 	}
 
-	area := p[areaName]
+	area := p.Areas[areaName]
 
 	return area
 }
 
-var lastHostPortPair map[string]bool
+// IsTargeted reports whether answers from platName depend on the client
+// location, that is whether it has areas besides the default one.
+func (ps Plats) IsTargeted(platName string) bool {
+	p := ps[platName]
+	if p == nil {
+		return false
+	}
+
+	for areaName := range p.Areas {
+		if areaName != defaultArea {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	lastHealthChecks map[string]bool
 
+	hcMutex sync.Mutex
+)
+
+// HealthCheck registers the checks of all nodes with the hc scheduler
+// and drops the checks of nodes that are gone.
 func (ps Plats) HealthCheck(changed bool) {
 	if !changed {
 		return
 	}
 
-	healths := NewHcs()
+	hcMutex.Lock()
+	defer hcMutex.Unlock()
 
 	tmp := make(map[string]bool)
 
 	for _, plat := range ps {
+		for _, area := range plat.Areas {
+			for _, nodes := range [][]*Node{area.IPV4nodes, area.IPV6nodes} {
+				for _, n := range nodes {
+					if n.Hc == nil || n.State == StateMaintenance {
+						continue
+					}
+
+					key, err := hc.Std.Add(n.Addr, n.Hc)
+					if err != nil {
+						log.Printf("Failed to add health check %s: %s\n", key, err)
+						continue
+					}
+
+					tmp[key] = true
+				}
+			}
+		}
+	}
 
-		for _, area := range plat {
+	for pre := range lastHealthChecks {
+		if _, ok := tmp[pre]; !ok {
+			hc.Std.Del(pre)
+		}
+	}
 
-			ipv4s := area.IPV4nodes
-			ipv6s := area.IPV6nodes
+	lastHealthChecks = tmp
+}
 
-			for i := 0; i < len(ipv4s); i++ {
-				v4node := ipv4s[i]
+// Selection describes how SearchPlatNode answered.
+type Selection struct {
+	Platform string   // the platform searched, also when no area answered
+	Area     string   // the area that answered
+	Policy   string   // the policy applied when no area had healthy nodes
+	Cname    string   // target of the fallback-cname policy
+	Hashed   bool     // picked by the client subnet
+	Targets  []string // the areas tried for the client
+	Netmask  int      // prefix length of the client address that decided them
+}
 
-				if v4node.Hc == nil {
-					continue
-				}
+// SearchPlatNode tries the areas in areaNames in order, walking the
+// fallback list of each one, until an area has healthy active nodes, or
+// enough of them for a tier. Drained nodes are only tried in a second
+// walk when no area has. When none has either, the policy of the first
+// area found decides the answer, tiers return nothing instead.
+func (ps Plats) SearchPlatNode(platName string, areaNames []string, q Query) ([]string, Selection) {
+	plat := ps[platName]
 
-				if healths.Exists(v4node.Addr, v4node.Hc.Type, v4node.Hc.Port) {
-					continue
-				}
+	if plat == nil {
+		return nil, Selection{Platform: platName}
+	}
+
+	if len(q.Selection) == 0 {
+		q.Selection = plat.Options.Selection
+	}
+	hashed := q.Selection == SelectionConsistentHash
+	if hashed {
+		q.key = clientKey(q.Client)
+	}
+	q.slowStart = plat.Options.SlowStart
 
-				healths.Add(v4node.Addr, v4node.Hc.Type, v4node.Hc.Port)
+	var first string
 
-				key := fmt.Sprintf("%s:%d-%s", v4node.Addr, v4node.Hc.Port, v4node.Hc.Type)
-				tmp[key] = true
-			}
+	var seen map[string]bool
+	var search func(names []string, drained bool) ([]string, string)
 
-			for i := 0; i < len(ipv6s); i++ {
-				v6node := ipv6s[i]
+	search = func(names []string, drained bool) ([]string, string) {
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
 
-				if v6node.Hc == nil {
-					continue
-				}
+			area := plat.Areas[name]
+			if area == nil {
+				continue
+			}
 
-				if healths.Exists(v6node.Addr, v6node.Hc.Type, v6node.Hc.Port) {
-					continue
-				}
+			if len(first) == 0 {
+				first = name
+			}
 
-				healths.Add(v6node.Addr, v6node.Hc.Type, v6node.Hc.Port)
+			if res := area.pickFrom(q, drained); len(res) > 0 {
+				return res, name
+			}
 
-				key := fmt.Sprintf("%s:%d-%s", v6node.Addr, v6node.Hc.Port, v6node.Hc.Type)
-				tmp[key] = true
+			if res, answered := search(area.Fallback, drained); len(res) > 0 {
+				return res, answered
 			}
 		}
-	}
 
-	if lastHostPortPair == nil {
-		lastHostPortPair = tmp
-		return
+		return nil, ""
 	}
 
-	for pre := range lastHostPortPair {
-		if _, ok := tmp[pre]; !ok {
-			healths.Del(pre)
+	for _, drained := range []bool{false, true} {
+		seen = make(map[string]bool)
+		if res, answered := search(areaNames, drained); len(res) > 0 {
+			return res, Selection{Platform: platName, Area: answered, Hashed: hashed}
 		}
 	}
 
-	lastHostPortPair = tmp
-}
-
-func (ps Plats) SearchPlatNode(platName string, areaName string, qtype uint16, max int) (res []string) {
-	area := ps.GetPlatAreaInfo(platName, areaName)
-	if area == nil {
-		return nil
+	if len(first) == 0 || q.tier {
+		return nil, Selection{Platform: platName}
 	}
 
-	hcs := NewHcs()
-
-	var (
-		sum   int
-		nodes []*node
-	)
-	if qtype == dns.TypeA {
-		sum = area.ipv4Weight
-		nodes = area.IPV4nodes
-	} else {
-		sum = area.ipv6Weight
-		nodes = area.IPV6nodes
-	}
-
-	if max > len(nodes) {
-		max = len(nodes)
+	area := plat.Areas[first]
+	sel := Selection{Platform: platName, Area: first, Policy: area.Policy}
+	if len(sel.Policy) == 0 {
+		sel.Policy = plat.Options.Policy
 	}
 
-	if sum == 0 {
-		for i := range nodes {
-			if nodes[i].Hc == nil || hcs.IsHealthy(nodes[i].Addr, nodes[i].Hc.Port) {
-				res = append(res, nodes[i].Addr)
-			}
+	switch sel.Policy {
+	case PolicyFailOpen:
+		sel.Hashed = hashed
+		return area.pick(q, false), sel
+	case PolicyFallbackCname:
+		sel.Cname = area.FallbackCname
+		if len(sel.Cname) == 0 {
+			sel.Cname = plat.Options.FallbackCname
 		}
-
-		return res 
+		return nil, sel
+	default:
+		sel.Policy = PolicyFailClosed
+		return nil, sel
 	}
+}
 
-	for si := 0; si < max; si++ {
-		n := rand.Intn(sum + 1)
-		s := 0
-
-		for i := range nodes {
-			s += int(nodes[i].Weight)
-			if s >= n {
-				sum -= nodes[i].Weight
-
-				if nodes[i].Hc == nil || hcs.IsHealthy(nodes[i].Addr, nodes[i].Hc.Port) {
-					res = append(res, nodes[i].Addr)
-				}
+func (n *Node) healthy() bool {
+	return n.Hc == nil || hc.Std.IsHealthy(n.hcKey)
+}
 
-				nodes = append(nodes[:i], nodes[i+1:]...)
-				break
-			}
-		}
+// rtt is the smoothed RTT of the health check of n, false without one.
+func (n *Node) rtt() (time.Duration, bool) {
+	if n.Hc == nil {
+		return 0, false
 	}
 
-	return res
+	return hc.Std.RTT(n.hcKey)
 }
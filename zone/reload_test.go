@@ -0,0 +1,142 @@
+package zone
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testNodes = `{
+	"@": {"A": [{"ip": "1.1.1.1", "weight": 3}, {"ip": "1.1.1.2", "weight": 1}, {"ip": "1.1.1.3", "weight": 5}]},
+	"x": {"A": [{"ip": "2.2.2.2", "weight": 1}, {"ip": "2.2.2.3", "weight": 2}], "fallback": ["@"]}
+}`
+	testAreas = `{"x": ["10.0.0.0/8"]}`
+	testZone  = `{"ttl": 60, "data": {"": {"ns": ["ns1.example.com"]}, "www": {}}}`
+)
+
+type testWriter struct{ dns.ResponseWriter }
+
+func (testWriter) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.ParseIP("10.1.2.3"), Port: 53}
+}
+
+func (testWriter) WriteMsg(m *dns.Msg) error { return nil }
+
+func writeTestFile(t *testing.T, dir string, name string, data string) string {
+	fn := filepath.Join(dir, name)
+	if err := os.WriteFile(fn, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return fn
+}
+
+// TestConcurrentReload answers queries while the platforms, areas and
+// zones are reloaded and changed through the update functions. Run it
+// with -race.
+func TestConcurrentReload(t *testing.T) {
+	dir := t.TempDir()
+	nodes := writeTestFile(t, dir, "nodes.json", testNodes)
+	areas := writeTestFile(t, dir, "areas.json", testAreas)
+	zoneFile := writeTestFile(t, dir, "zone.json", testZone)
+
+	reload := func() {
+		err := UpdatePlats(func(ps Plats) error { return ps.AddPlatInfo("example.com", nodes) })
+		if err != nil {
+			t.Error(err)
+		}
+		err = UpdateTargets(func(ts Targets) error { return ts.AddTargetInfo("example.com", areas) })
+		if err != nil {
+			t.Error(err)
+		}
+		err = UpdateZones(func(zs Zones) error {
+			z, err := zs.AddZoneInfo("example.com", "example.com", zoneFile)
+			if err == nil {
+				zs[z.Origin] = z
+			}
+			return err
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	reload()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(stop)
+
+		for i := 0; i < 100; i++ {
+			reload()
+
+			switch i % 10 {
+			case 3:
+				if err := SetArea("example.com", "y", &Area{IPV4nodes: []*Node{{Addr: "3.3.3.3", Weight: 1}}}); err != nil {
+					t.Error(err)
+				}
+			case 6:
+				if err := SetNodeState("example.com", "2.2.2.2", StateDrain); err != nil {
+					t.Error(err)
+				}
+			case 9:
+				if err := SetNodeState("example.com", "2.2.2.2", StateActive); err != nil {
+					t.Error(err)
+				}
+			}
+		}
+	}()
+
+	client := net.ParseIP("10.1.2.3")
+
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				switch g % 3 {
+				case 0:
+					m := new(dns.Msg)
+					m.SetQuestion("www.example.com.", dns.TypeA)
+					z := CurrentZones().match(m.Question[0].Name)
+					if z == nil {
+						t.Error("no zone for www.example.com")
+						return
+					}
+					serve(testWriter{}, m, z)
+				case 1:
+					z := CurrentZones()["example.com"]
+					if label := z.Labels["www"]; label != nil {
+						if res, _ := label.Picker(dns.TypeA, 2, client); len(res) == 0 {
+							t.Error("no answer from Picker")
+							return
+						}
+					}
+				default:
+					q := Query{Qtype: dns.TypeA, Max: 2, Client: client}
+					if res, _ := CurrentPlats().SearchPlatNode("example.com", []string{"x", "@"}, q); len(res) == 0 {
+						t.Error("no answer from SearchPlatNode")
+						return
+					}
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,145 @@
+package zone
+
+import (
+	"hash/fnv"
+	"math"
+	"net"
+)
+
+// selection modes, weighted is the default
+const (
+	SelectionWeighted       = "weighted"
+	SelectionConsistentHash = "consistent-hash"
+	SelectionFastest        = "fastest"
+)
+
+// ValidSelection reports whether s is a selection mode, an empty one
+// means the default.
+func ValidSelection(s string) bool {
+	switch s {
+	case "", SelectionWeighted, SelectionConsistentHash, SelectionFastest:
+		return true
+	}
+
+	return false
+}
+
+// ring orders weighted items for a key with weighted rendezvous
+// hashing: each item scores the key from its own name and weight and the
+// highest score comes first. An item's score doesn't depend on the other
+// items, so removing one only moves the keys it had and adding one only
+// takes keys to it, in proportion to the weights.
+type ring struct {
+	hashes  []uint64
+	weights []float64
+}
+
+// newRing puts the items with a positive weight on a ring, names decide
+// their scores.
+func newRing(names []string, weights []int) *ring {
+	r := &ring{
+		hashes:  make([]uint64, len(names)),
+		weights: make([]float64, len(names)),
+	}
+
+	usable := false
+	for i, w := range weights {
+		if w > 0 {
+			r.hashes[i] = hash64([]byte(names[i]))
+			r.weights[i] = float64(w)
+			usable = true
+		}
+	}
+	if !usable {
+		return nil
+	}
+
+	return r
+}
+
+// score is the weight of item i over -ln of a uniform draw from its hash
+// and key, the highest score of each key is picked in proportion to the
+// weights.
+func (r *ring) score(i int, key uint64) float64 {
+	h := mix64(r.hashes[i] ^ key)
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+
+	return r.weights[i] / -math.Log(u)
+}
+
+// walk calls fn with each item with a weight once, in order of their
+// score for key, until fn returns false.
+func (r *ring) walk(key uint64, fn func(item int) bool) {
+	if r == nil {
+		return
+	}
+
+	scores := make([]float64, len(r.weights))
+	for i, w := range r.weights {
+		if w > 0 {
+			scores[i] = r.score(i, key)
+		}
+	}
+
+	// usually only the first few are wanted, select instead of sorting
+	for {
+		best := -1
+		for i, s := range scores {
+			if s > 0 && (best < 0 || s > scores[best]) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return
+		}
+		scores[best] = 0
+
+		if !fn(best) {
+			return
+		}
+	}
+}
+
+// clientBits is the prefix length of ip that consistent hashing uses,
+// /24 for IPv4 and /56 for IPv6.
+func clientBits(ip net.IP) int {
+	if ip.To4() != nil {
+		return 24
+	}
+
+	return 56
+}
+
+// clientKey is the ring key of the subnet of ip.
+func clientKey(ip net.IP) uint64 {
+	if ip4 := ip.To4(); ip4 != nil {
+		return hash64(ip4.Mask(net.CIDRMask(clientBits(ip), 32)))
+	}
+
+	return hash64(ip.Mask(net.CIDRMask(clientBits(ip), 128)))
+}
+
+// hash64 is FNV-1a with a splitmix64 finalizer, FNV alone spreads
+// similar names poorly.
+func hash64(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+
+	return mix64(h.Sum64())
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return x
+}
+
+// ringKey is the rdata of a label record, it names the record on a ring.
+func ringKey(r Record) string {
+	return r.RR.String()[len(r.RR.Header().String()):]
+}
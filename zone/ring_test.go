@@ -0,0 +1,147 @@
+package zone
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func ringNodes(count int, weight func(i int) int) []*Node {
+	var nodes []*Node
+	for i := 0; i < count; i++ {
+		nodes = append(nodes, &Node{Addr: fmt.Sprintf("10.0.0.%d", i), Weight: weight(i)})
+	}
+
+	return nodes
+}
+
+func ringPick(p *picker, ip net.IP) string {
+	res := p.pick(Query{Max: 1, Selection: SelectionConsistentHash, key: clientKey(ip)}, true)
+	if len(res) == 0 {
+		return ""
+	}
+
+	return res[0]
+}
+
+func TestRingStable(t *testing.T) {
+	nodes := ringNodes(10, func(i int) int { return 1 + i%3 })
+	p := newPicker(nodes, nil)
+
+	const clients = 20000
+
+	before := make([]string, clients)
+	counts := make(map[string]int)
+
+	for c := 0; c < clients; c++ {
+		before[c] = ringPick(p, net.IPv4(10, byte(c>>8), byte(c), 7))
+		counts[before[c]]++
+
+		// the same /24
+		if other := ringPick(p, net.IPv4(10, byte(c>>8), byte(c), 200)); other != before[c] {
+			t.Fatalf("client %d: %s and %s for the same /24", c, before[c], other)
+		}
+	}
+
+	sum := 0
+	for _, n := range nodes {
+		sum += n.Weight
+	}
+
+	// about in proportion to the weights, 1:2:3
+	for _, n := range nodes {
+		expected := float64(clients*n.Weight) / float64(sum)
+		if got := float64(counts[n.Addr]); got < expected/2 || got > expected*2 {
+			t.Errorf("%s has %d clients, expected about %.0f", n.Addr, counts[n.Addr], expected)
+		}
+	}
+
+	// removing a node only moves its clients
+	checkRemoval(t, nodes, 3, clients)
+}
+
+func TestRingRemoval(t *testing.T) {
+	tests := []struct {
+		weights []int
+		remove  int
+	}{
+		// the divisor of the weights goes from 1 to 2
+		{[]int{1, 2, 2}, 0},
+		// the heaviest node goes
+		{[]int{1, 1, 100}, 2},
+		{[]int{1000, 3000, 500, 500}, 1},
+		{[]int{3, 6, 9, 0}, 2},
+	}
+
+	for _, tt := range tests {
+		weights := tt.weights
+		checkRemoval(t, ringNodes(len(weights), func(i int) int { return weights[i] }), tt.remove, 20000)
+	}
+}
+
+// checkRemoval fails when removing nodes[remove] moves a client that
+// wasn't on it.
+func checkRemoval(t *testing.T, nodes []*Node, remove int, clients int) {
+	t.Helper()
+
+	p := newPicker(nodes, nil)
+	removed := nodes[remove]
+	rest := append(append([]*Node{}, nodes[:remove]...), nodes[remove+1:]...)
+	p2 := newPicker(rest, nil)
+
+	for c := 0; c < clients; c++ {
+		ip := net.IPv4(10, byte(c>>8), byte(c), 7)
+		before, after := ringPick(p, ip), ringPick(p2, ip)
+
+		if before == removed.Addr {
+			if after == removed.Addr {
+				t.Fatalf("client %d still on the removed node", c)
+			}
+			continue
+		}
+		if after != before {
+			t.Fatalf("removing %s: client %d moved from %s to %s", removed.Addr, c, before, after)
+		}
+	}
+}
+
+func TestRingIPv6(t *testing.T) {
+	p := newPicker(ringNodes(5, func(int) int { return 1 }), nil)
+
+	a := ringPick(p, net.ParseIP("2001:db8:1:100::1"))
+	if b := ringPick(p, net.ParseIP("2001:db8:1:1ff::2")); a != b {
+		t.Errorf("%s and %s for the same /56", a, b)
+	}
+}
+
+func TestRingLazy(t *testing.T) {
+	if newRing([]string{"a"}, []int{0}) != nil {
+		t.Error("ring without weight")
+	}
+
+	// built only when used
+	p := newPicker(ringNodes(50, func(int) int { return 1000 }), nil)
+	if p.ring != nil {
+		t.Error("ring built before consistent-hash used it")
+	}
+	ringPick(p, net.IPv4(10, 1, 2, 3))
+	if p.ring == nil {
+		t.Error("ring not built")
+	}
+
+	// every node with a weight once, none without
+	r := newRing([]string{"a", "b", "c", "d"}, []int{1, 0, 5, 2})
+	var items []int
+	r.walk(42, func(i int) bool {
+		items = append(items, i)
+		return true
+	})
+	if len(items) != 3 {
+		t.Errorf("walked %v, want 3 items", items)
+	}
+	for _, i := range items {
+		if i == 1 {
+			t.Errorf("walked %v with the item without weight", items)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package zone
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule changes the weight of a node, or of all nodes of an area, by
+// the time. The first rule that matches the current time applies, the
+// configured weight holds when none does.
+type Schedule []*ScheduleRule
+
+// ScheduleRule sets the weight, or a percentage of it, while all its
+// conditions hold:
+//
+//	{"weight": 10, "hours": "19:00-23:00", "timezone": "Asia/Shanghai"}
+//	{"percent": 0, "from": "2026-11-10", "to": "2026-11-11"}
+//
+// Hours may wrap past midnight, the same start and end cover the whole
+// day. Days are "mon" to "sun" and check the current day. From and To
+// are dates, "2006-01-02 15:04" or RFC 3339 times, a To date includes
+// the whole day. Times are in Timezone, the local one by default.
+type ScheduleRule struct {
+	Weight   *int     `json:"weight,omitempty"`
+	Percent  *int     `json:"percent,omitempty"`
+	Hours    string   `json:"hours,omitempty"`
+	Days     []string `json:"days,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       string   `json:"to,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+
+	loc        *time.Location
+	start, end int // minutes of the day, end excluded, -1 without hours
+	days       uint8
+	from, to   time.Time
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func (r *ScheduleRule) UnmarshalJSON(b []byte) error {
+	// without the methods of ScheduleRule
+	type rule ScheduleRule
+
+	if err := json.Unmarshal(b, (*rule)(r)); err != nil {
+		return err
+	}
+
+	if err := r.compile(); err != nil {
+		return fmt.Errorf("schedule %s: %s", b, err)
+	}
+
+	return nil
+}
+
+func (r *ScheduleRule) compile() error {
+	if (r.Weight == nil) == (r.Percent == nil) {
+		return errors.New("needs one of weight and percent")
+	}
+	if r.Weight != nil && *r.Weight < 0 || r.Percent != nil && *r.Percent < 0 {
+		return errors.New("negative weight")
+	}
+
+	r.loc = time.Local
+	if len(r.Timezone) > 0 {
+		loc, err := time.LoadLocation(r.Timezone)
+		if err != nil {
+			return err
+		}
+		r.loc = loc
+	}
+
+	r.start, r.end = -1, -1
+	if len(r.Hours) > 0 {
+		from, to, ok := strings.Cut(r.Hours, "-")
+		if !ok {
+			return fmt.Errorf("invalid hours %q", r.Hours)
+		}
+
+		var err error
+		if r.start, err = dayMinute(from); err != nil {
+			return err
+		}
+		if r.end, err = dayMinute(to); err != nil {
+			return err
+		}
+	}
+
+	r.days = 0
+	for _, d := range r.Days {
+		wd, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return fmt.Errorf("invalid day %q", d)
+		}
+		r.days |= 1 << wd
+	}
+
+	var err error
+	if len(r.From) > 0 {
+		if r.from, _, err = parseScheduleTime(r.From, r.loc); err != nil {
+			return err
+		}
+	}
+	if len(r.To) > 0 {
+		var date bool
+		if r.to, date, err = parseScheduleTime(r.To, r.loc); err != nil {
+			return err
+		}
+		if date {
+			r.to = r.to.AddDate(0, 0, 1)
+		}
+	}
+	if !r.from.IsZero() && !r.to.IsZero() && !r.to.After(r.from) {
+		return errors.New("to is not after from")
+	}
+
+	return nil
+}
+
+// dayMinute parses "15:04" into the minute of the day, "24:00" is the
+// end of it.
+func dayMinute(s string) (int, error) {
+	if strings.TrimSpace(s) == "24:00" {
+		return 24 * 60, nil
+	}
+
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseScheduleTime parses a From or To time, date reports whether it
+// was only a date.
+func parseScheduleTime(s string, loc *time.Location) (t time.Time, date bool, err error) {
+	if t, err = time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, true, nil
+	}
+	if t, err = time.ParseInLocation("2006-01-02 15:04", s, loc); err == nil {
+		return t, false, nil
+	}
+	if t, err = time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+
+	return t, false, fmt.Errorf("invalid time %q", s)
+}
+
+func (r *ScheduleRule) matches(now time.Time) bool {
+	if !r.from.IsZero() && now.Before(r.from) {
+		return false
+	}
+	if !r.to.IsZero() && !now.Before(r.to) {
+		return false
+	}
+
+	local := now.In(r.loc)
+
+	if r.days != 0 && r.days&(1<<local.Weekday()) == 0 {
+		return false
+	}
+
+	if r.start >= 0 {
+		m := local.Hour()*60 + local.Minute()
+		if r.start == r.end {
+			return true
+		}
+		if r.start < r.end {
+			return m >= r.start && m < r.end
+		}
+		return m >= r.start || m < r.end
+	}
+
+	return true
+}
+
+// apply returns weight as changed by the first rule of s that matches
+// now.
+func (s Schedule) apply(weight float64, now time.Time) float64 {
+	for _, r := range s {
+		if !r.matches(now) {
+			continue
+		}
+
+		if r.Weight != nil {
+			return float64(*r.Weight)
+		}
+		return weight * float64(*r.Percent) / 100
+	}
+
+	return weight
+}
+
+// scheduledWeight is the weight of n at now by its schedule and then
+// the one of its area.
+func (n *Node) scheduledWeight(area Schedule, now time.Time) float64 {
+	w := 0.0
+	if n.Weight > 0 {
+		w = float64(n.Weight)
+	}
+
+	return area.apply(n.Schedule.apply(w, now), now)
+}
@@ -0,0 +1,141 @@
+package zone
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func parseRule(t *testing.T, js string) *ScheduleRule {
+	t.Helper()
+
+	r := new(ScheduleRule)
+	if err := json.Unmarshal([]byte(js), r); err != nil {
+		t.Fatalf("%s: %s", js, err)
+	}
+
+	return r
+}
+
+func TestScheduleMatches(t *testing.T) {
+	// 2026-11-10 is a Tuesday
+	at := func(s string) time.Time {
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	tests := []struct {
+		rule string
+		now  string
+		want bool
+	}{
+		{`{"weight": 1}`, "2026-11-10T12:00:00Z", true},
+
+		// hours
+		{`{"weight": 1, "hours": "19:00-23:00", "timezone": "UTC"}`, "2026-11-10T19:00:00Z", true},
+		{`{"weight": 1, "hours": "19:00-23:00", "timezone": "UTC"}`, "2026-11-10T22:59:00Z", true},
+		{`{"weight": 1, "hours": "19:00-23:00", "timezone": "UTC"}`, "2026-11-10T23:00:00Z", false},
+		{`{"weight": 1, "hours": "19:00-23:00", "timezone": "UTC"}`, "2026-11-10T18:59:00Z", false},
+
+		// past midnight
+		{`{"weight": 1, "hours": "22:00-02:00", "timezone": "UTC"}`, "2026-11-10T23:30:00Z", true},
+		{`{"weight": 1, "hours": "22:00-02:00", "timezone": "UTC"}`, "2026-11-10T01:59:00Z", true},
+		{`{"weight": 1, "hours": "22:00-02:00", "timezone": "UTC"}`, "2026-11-10T02:00:00Z", false},
+		{`{"weight": 1, "hours": "22:00-02:00", "timezone": "UTC"}`, "2026-11-10T12:00:00Z", false},
+
+		// up to the end of the day
+		{`{"weight": 1, "hours": "20:00-24:00", "timezone": "UTC"}`, "2026-11-10T23:59:00Z", true},
+		{`{"weight": 1, "hours": "20:00-24:00", "timezone": "UTC"}`, "2026-11-10T00:00:00Z", false},
+
+		// the same start and end, all day
+		{`{"weight": 1, "hours": "00:00-00:00", "timezone": "UTC"}`, "2026-11-10T13:00:00Z", true},
+		{`{"weight": 1, "hours": "00:00-24:00", "timezone": "UTC"}`, "2026-11-10T00:00:00Z", true},
+
+		// in the timezone, 19:00 in Shanghai is 11:00 UTC
+		{`{"weight": 1, "hours": "19:00-23:00", "timezone": "Asia/Shanghai"}`, "2026-11-10T11:30:00Z", true},
+		{`{"weight": 1, "hours": "19:00-23:00", "timezone": "Asia/Shanghai"}`, "2026-11-10T19:30:00Z", false},
+
+		// days, of the timezone
+		{`{"weight": 1, "days": ["tue"], "timezone": "UTC"}`, "2026-11-10T12:00:00Z", true},
+		{`{"weight": 1, "days": ["Mon", "wed"], "timezone": "UTC"}`, "2026-11-10T12:00:00Z", false},
+		{`{"weight": 1, "days": ["wed"], "timezone": "Asia/Shanghai"}`, "2026-11-10T17:00:00Z", true},
+		{`{"weight": 1, "days": ["sat", "sun"], "hours": "22:00-02:00", "timezone": "UTC"}`, "2026-11-14T23:00:00Z", true},
+		{`{"weight": 1, "days": ["sat", "sun"], "hours": "22:00-02:00", "timezone": "UTC"}`, "2026-11-10T23:00:00Z", false},
+
+		// dates, to includes the whole day
+		{`{"weight": 1, "from": "2026-11-10", "to": "2026-11-11", "timezone": "UTC"}`, "2026-11-10T00:00:00Z", true},
+		{`{"weight": 1, "from": "2026-11-10", "to": "2026-11-11", "timezone": "UTC"}`, "2026-11-11T23:59:00Z", true},
+		{`{"weight": 1, "from": "2026-11-10", "to": "2026-11-11", "timezone": "UTC"}`, "2026-11-12T00:00:00Z", false},
+		{`{"weight": 1, "from": "2026-11-10", "to": "2026-11-11", "timezone": "UTC"}`, "2026-11-09T23:59:00Z", false},
+		{`{"weight": 1, "from": "2026-11-10 20:00", "timezone": "Asia/Shanghai"}`, "2026-11-10T11:59:00Z", false},
+		{`{"weight": 1, "from": "2026-11-10 20:00", "timezone": "Asia/Shanghai"}`, "2026-11-10T12:00:00Z", true},
+		{`{"weight": 1, "to": "2026-11-10T20:00:00+08:00"}`, "2026-11-10T12:00:00Z", false},
+		{`{"weight": 1, "to": "2026-11-10T20:00:00+08:00"}`, "2026-11-10T11:59:00Z", true},
+	}
+
+	for _, tt := range tests {
+		if got := parseRule(t, tt.rule).matches(at(tt.now)); got != tt.want {
+			t.Errorf("%s at %s: got %v, want %v", tt.rule, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleCompile(t *testing.T) {
+	for _, bad := range []string{
+		`{}`,
+		`{"weight": 1, "percent": 50}`,
+		`{"weight": -1}`,
+		`{"percent": -1}`,
+		`{"weight": 1, "hours": "19:00"}`,
+		`{"weight": 1, "hours": "19:00-25:00"}`,
+		`{"weight": 1, "days": ["someday"]}`,
+		`{"weight": 1, "timezone": "Mars/Olympus"}`,
+		`{"weight": 1, "from": "tomorrow"}`,
+		`{"weight": 1, "from": "2026-11-11", "to": "2026-11-10"}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), new(ScheduleRule)); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
+
+func TestScheduleApply(t *testing.T) {
+	var s Schedule
+	err := json.Unmarshal([]byte(`[
+	{"weight": 10, "hours": "19:00-23:00", "timezone": "UTC"},
+	{"percent": 50, "hours": "12:00-20:00", "timezone": "UTC"},
+	{"weight": 0, "from": "2026-11-11", "to": "2026-11-11", "timezone": "UTC"}
+]`), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		now  time.Time
+		want float64
+	}{
+		{time.Date(2026, 11, 10, 8, 0, 0, 0, time.UTC), 40},
+		// a percentage of the weight
+		{time.Date(2026, 11, 10, 13, 0, 0, 0, time.UTC), 20},
+		// the first rule that matches
+		{time.Date(2026, 11, 10, 19, 30, 0, 0, time.UTC), 10},
+		{time.Date(2026, 11, 11, 8, 0, 0, 0, time.UTC), 0},
+	}
+
+	for _, tt := range tests {
+		if got := s.apply(40, tt.now); got != tt.want {
+			t.Errorf("at %s: got %v, want %v", tt.now, got, tt.want)
+		}
+	}
+
+	// the node's schedule and then the area's
+	ten := 10
+	n := &Node{Weight: 40, Schedule: Schedule{{Weight: &ten, start: -1, end: -1, loc: time.UTC}}}
+	if got := n.scheduledWeight(s, time.Date(2026, 11, 10, 13, 0, 0, 0, time.UTC)); got != 5 {
+		t.Errorf("scheduled weight %v, want 5", got)
+	}
+}
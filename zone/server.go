@@ -8,6 +8,7 @@ import (
 
 	"github.com/miekg/dns"
 	"github.com/rench1988/gslb-dns/log"
+	"github.com/rench1988/gslb-dns/metrics"
 	"github.com/rench1988/gslb-dns/qlog"
 )
 
@@ -29,6 +30,8 @@ func ListenAndServe(ip string) {
 
 func serve(w dns.ResponseWriter, req *dns.Msg, z *Zone) {
 
+	start := time.Now()
+
 	qname := req.Question[0].Name
 	qtype := req.Question[0].Qtype
 
@@ -54,12 +57,15 @@ func serve(w dns.ResponseWriter, req *dns.Msg, z *Zone) {
 	// IP that's talking to us (not EDNS CLIENT SUBNET)
 	var realIP net.IP
 
+	transport := "udp"
+
 	if addr, ok := w.RemoteAddr().(*net.UDPAddr); ok {
 		realIP = make(net.IP, len(addr.IP))
 		copy(realIP, addr.IP)
 	} else if addr, ok := w.RemoteAddr().(*net.TCPAddr); ok {
 		realIP = make(net.IP, len(addr.IP))
 		copy(realIP, addr.IP)
+		transport = "tcp"
 	}
 	if qle != nil {
 		qle.RemoteAddr = realIP.String()
@@ -67,14 +73,12 @@ func serve(w dns.ResponseWriter, req *dns.Msg, z *Zone) {
 
 	var ip net.IP // EDNS or real IP
 	var edns *dns.EDNS0_SUBNET
-	var opt_rr *dns.OPT
 
 	for _, extra := range req.Extra {
 
 		switch extra.(type) {
 		case *dns.OPT:
 			for _, o := range extra.(*dns.OPT).Option {
-				opt_rr = extra.(*dns.OPT)
 				switch e := o.(type) {
 				case *dns.EDNS0_NSID:
 					// do stuff with e.Nsid
@@ -101,18 +105,16 @@ func serve(w dns.ResponseWriter, req *dns.Msg, z *Zone) {
 		}
 	}
 
-	//下面这个要改成根据ip寻找对应区域的逻辑
-	//targets, netmask := z.Options.Targeting.GetTargets(ip)
 	targets := []string{"@"}
 
-	/*
-		if qle != nil {
-			qle.Targets = targets
-		}
-	*/
-
 	m := new(dns.Msg)
 
+	var sel Selection
+
+	defer func() {
+		metrics.Query(z.Origin, qtype, m.Rcode, sel.Area, transport, m.Len(), time.Since(start))
+	}()
+
 	if qle != nil {
 		defer func() {
 			qle.Rcode = m.Rcode
@@ -121,24 +123,11 @@ func serve(w dns.ResponseWriter, req *dns.Msg, z *Zone) {
 	}
 
 	m.SetReply(req)
-	if e := m.IsEdns0(); e != nil {
+	if e := req.IsEdns0(); e != nil {
 		m.SetEdns0(4096, e.Do())
 	}
 	m.Authoritative = true
 
-	// TODO: set scope to 0 if there are no alternate responses
-	if edns != nil {
-		if edns.Family != 0 {
-			/*
-				if netmask < 16 {
-					netmask = 16
-				}
-				edns.SourceScope = uint8(netmask)
-			*/
-			m.Extra = append(m.Extra, opt_rr)
-		}
-	}
-
 	labels, labelQtype := z.findLabels(label, targets, qTypes{dns.TypeMF, dns.TypeCNAME, qtype})
 	if labelQtype == 0 {
 		labelQtype = qtype
@@ -157,11 +146,36 @@ func serve(w dns.ResponseWriter, req *dns.Msg, z *Zone) {
 
 		m.Ns = []dns.RR{z.SoaRR()}
 
+		setECS(m, edns, 0)
+
 		w.WriteMsg(m)
 		return
 	}
 
-	if servers := labels.Picker(labelQtype, labels.MaxHosts, "hunan"); servers != nil {
+	var servers Records
+	servers, sel = labels.Picker(labelQtype, labels.MaxHosts, ip)
+	if qle != nil {
+		qle.Targets = sel.Targets
+		if len(sel.Area) > 0 {
+			qle.Targets = []string{sel.Area}
+		}
+		qle.Policy = sel.Policy
+	}
+
+	// the scope is 0 unless the answer came from a platform with
+	// location specific areas, an empty answer too as other areas may
+	// have nodes
+	scope := 0
+	if CurrentPlats().IsTargeted(sel.Platform) {
+		scope = sel.Netmask
+	}
+	// consistent hashing answers each client subnet on its own
+	if sel.Hashed && scope < clientBits(ip) {
+		scope = clientBits(ip)
+	}
+	setECS(m, edns, scope)
+
+	if servers != nil {
 		var rrs []dns.RR
 		for _, record := range servers {
 			rr := dns.Copy(record.RR)
@@ -192,6 +206,27 @@ func serve(w dns.ResponseWriter, req *dns.Msg, z *Zone) {
 	return
 }
 
+// setECS answers the client subnet option of the query, RFC 7871, with
+// the given scope prefix length.
+func setECS(m *dns.Msg, edns *dns.EDNS0_SUBNET, scope int) {
+	if edns == nil || edns.Family == 0 {
+		return
+	}
+
+	opt := m.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        edns.Family,
+		SourceNetmask: edns.SourceNetmask,
+		SourceScope:   uint8(scope),
+		Address:       edns.Address,
+	})
+}
+
 func getQuestionName(z *Zone, req *dns.Msg) string {
 	lx := dns.SplitDomainName(req.Question[0].Name)
 	ql := lx[0 : len(lx)-z.LabelCount]
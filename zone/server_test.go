@@ -0,0 +1,109 @@
+package zone
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// msgWriter keeps the answer of serve.
+type msgWriter struct {
+	testWriter
+	msg *dns.Msg
+}
+
+func (w *msgWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+// loadTestZone sets up origin as a zone of platform origin with the
+// given nodes and areas.
+func loadTestZone(t *testing.T, origin string, nodes string, areas string) {
+	dir := t.TempDir()
+	nodesFile := writeTestFile(t, dir, "nodes.json", nodes)
+	areasFile := writeTestFile(t, dir, "areas.json", areas)
+	zoneFile := writeTestFile(t, dir, "zone.json", testZone)
+
+	err := UpdatePlats(func(ps Plats) error { return ps.AddPlatInfo(origin, nodesFile) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = UpdateTargets(func(ts Targets) error { return ts.AddTargetInfo(origin, areasFile) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = UpdateZones(func(zs Zones) error {
+		z, err := zs.AddZoneInfo(origin, origin, zoneFile)
+		if err == nil {
+			zs[z.Origin] = z
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveECS answers an A query for name from client and returns the
+// answer count and the ECS scope.
+func serveECS(t *testing.T, name string, client string) (int, int) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, dns.TypeA)
+	m.SetEdns0(4096, false)
+	m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        1,
+		SourceNetmask: 32,
+		Address:       net.ParseIP(client).To4(),
+	})
+
+	z := CurrentZones().match(name)
+	if z == nil {
+		t.Fatalf("no zone for %s", name)
+	}
+
+	w := &msgWriter{}
+	serve(w, m, z)
+	if w.msg == nil {
+		t.Fatalf("%s: no answer", name)
+	}
+
+	for _, o := range w.msg.IsEdns0().Option {
+		if e, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return len(w.msg.Answer), int(e.SourceScope)
+		}
+	}
+
+	t.Fatalf("%s: no ECS option in the answer", name)
+	return 0, 0
+}
+
+func TestServeScope(t *testing.T) {
+	// only an area for 10.0.0.0/8, no default
+	loadTestZone(t, "scope.example", `{"cn": {"A": [{"ip": "2.2.2.2", "weight": 1}]}}`, `{"cn": ["10.0.0.0/8"]}`)
+	// only the default area
+	loadTestZone(t, "flat.example", `{"@": {"A": [{"ip": "1.1.1.1", "weight": 1}]}}`, `{}`)
+
+	tests := []struct {
+		name    string
+		client  string
+		answers int
+		scope   int
+	}{
+		{"www.scope.example.", "10.1.2.3", 1, 8},
+		// empty for this client only, 192/1 doesn't start with the
+		// bit of 10/8
+		{"www.scope.example.", "192.168.1.1", 0, 1},
+		{"www.flat.example.", "10.1.2.3", 1, 0},
+	}
+
+	for _, tt := range tests {
+		answers, scope := serveECS(t, tt.name, tt.client)
+		if answers != tt.answers || scope != tt.scope {
+			t.Errorf("%s from %s: %d answers with scope %d, want %d with scope %d",
+				tt.name, tt.client, answers, scope, tt.answers, tt.scope)
+		}
+	}
+}
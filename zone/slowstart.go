@@ -0,0 +1,123 @@
+package zone
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/rench1988/gslb-dns/hc"
+)
+
+// slow start modes, linear is the default
+const (
+	RampLinear      = "linear"
+	RampExponential = "exponential"
+)
+
+// the fraction of its weight a node starts from by default
+const defaultRampStart = 0.1
+
+// SlowStart ramps up the weight of nodes that come back up, are added or
+// leave drain or maintenance, from Start of it to all of it in Window
+// seconds. It's off without a window.
+type SlowStart struct {
+	Window int     `json:"window"`
+	Mode   string  `json:"mode"`
+	Start  float64 `json:"start"`
+}
+
+func (s SlowStart) Validate() error {
+	if s.Window < 0 {
+		return errors.New("negative window")
+	}
+
+	switch s.Mode {
+	case "", RampLinear, RampExponential:
+	default:
+		return errors.New("unknown mode " + s.Mode)
+	}
+
+	if s.Start < 0 || s.Start >= 1 {
+		return errors.New("start must be a fraction between 0 and 1")
+	}
+
+	return nil
+}
+
+func (s SlowStart) start() float64 {
+	if s.Start > 0 {
+		return s.Start
+	}
+
+	return defaultRampStart
+}
+
+// rampFactor is the part of its weight n gets at now, 1 when it's not
+// ramping up.
+func (n *Node) rampFactor(s SlowStart, now time.Time) float64 {
+	if s.Window <= 0 {
+		return 1
+	}
+
+	since := n.since
+	if n.Hc != nil {
+		if up := hc.Std.UpSince(n.hcKey); up.After(since) {
+			since = up
+		}
+	}
+	if since.IsZero() {
+		return 1
+	}
+
+	window := time.Duration(s.Window) * time.Second
+	elapsed := now.Sub(since)
+	if elapsed < 0 || elapsed >= window {
+		return 1
+	}
+
+	x := float64(elapsed) / float64(window)
+	start := s.start()
+
+	if s.Mode == RampExponential {
+		return start * math.Pow(1/start, x)
+	}
+
+	return start + (1-start)*x
+}
+
+// carrySince sets when the nodes of areas came into service. Nodes that
+// were active in old keep their time, new ones and ones back from drain
+// or maintenance start now. Without old nothing ramps up.
+func (areas Areas) carrySince(old Areas, now time.Time) {
+	if old == nil {
+		return
+	}
+
+	prev := make(map[string]*Node)
+	for _, area := range old {
+		for _, nodes := range [][]*Node{area.IPV4nodes, area.IPV6nodes} {
+			for _, n := range nodes {
+				if p, ok := prev[n.Addr]; !ok || p.State != StateActive && p.State != "" {
+					prev[n.Addr] = n
+				}
+			}
+		}
+	}
+
+	for _, area := range areas {
+		for _, nodes := range [][]*Node{area.IPV4nodes, area.IPV6nodes} {
+			for _, n := range nodes {
+				if n.State != StateActive && n.State != "" {
+					continue
+				}
+
+				p, ok := prev[n.Addr]
+				if ok && (p.State == StateActive || p.State == "") {
+					n.since = p.since
+				} else {
+					n.since = now
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package zone
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var (
+	ErrNoPlat   = errors.New("platform not found")
+	ErrNoArea   = errors.New("area not found")
+	ErrNoNode   = errors.New("node not found")
+	ErrBadIP    = errors.New("invalid node address")
+	ErrBadState = errors.New("invalid node state")
+	ErrBadCap   = errors.New("invalid node capacity")
+	ErrBadHc    = errors.New("invalid health check")
+	ErrBadArea  = errors.New("invalid area")
+)
+
+// PlatNames returns the names of the loaded platforms.
+func (ps Plats) PlatNames() []string {
+	names := make([]string, 0, len(ps))
+	for name := range ps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// GetAreas returns a copy of the areas of platName.
+func (ps Plats) GetAreas(platName string) (Areas, error) {
+	p := ps[platName]
+	if p == nil {
+		return nil, ErrNoPlat
+	}
+
+	return p.Areas.clone()
+}
+
+// UpdateAreas applies fn to a copy of the areas of platName, writes the
+// result to the node file of the platform and then swaps it in.
+func UpdateAreas(platName string, fn func(Areas) error) error {
+	err := UpdatePlats(func(ps Plats) error {
+		p := ps[platName]
+		if p == nil {
+			return ErrNoPlat
+		}
+
+		areas, err := p.Areas.clone()
+		if err != nil {
+			return err
+		}
+
+		if err = fn(areas); err != nil {
+			return err
+		}
+
+		areas.carrySince(p.Areas, time.Now())
+		areas.prepare()
+
+		if err = writeAreas(p.File, areas); err != nil {
+			return err
+		}
+
+		ps[platName] = &Plat{Areas: areas, Options: p.Options, File: p.File}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	CurrentPlats().HealthCheck(true)
+
+	return nil
+}
+
+// SetArea adds areaName to platName or replaces it.
+func SetArea(platName string, areaName string, area *Area) error {
+	for _, nodes := range [][]*Node{area.IPV4nodes, area.IPV6nodes} {
+		for _, n := range nodes {
+			if err := n.validate(); err != nil {
+				return err
+			}
+			if err := n.validateHc(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !ValidPolicy(area.Policy) {
+		return fmt.Errorf("%w: unknown policy %q", ErrBadArea, area.Policy)
+	}
+
+	if p := CurrentPlats()[platName]; p != nil {
+		if err := area.checkCname(p.Options); err != nil {
+			return fmt.Errorf("%w: fallback_cname %s", ErrBadArea, err)
+		}
+	}
+
+	return UpdateAreas(platName, func(areas Areas) error {
+		for _, name := range area.Fallback {
+			if _, ok := areas[name]; !ok || name == areaName {
+				return fmt.Errorf("%w: bad fallback area %q", ErrBadArea, name)
+			}
+		}
+
+		areas[areaName] = area
+		return nil
+	})
+}
+
+// DeleteArea removes areaName from platName, unless another area falls
+// back to it.
+func DeleteArea(platName string, areaName string) error {
+	return UpdateAreas(platName, func(areas Areas) error {
+		if _, ok := areas[areaName]; !ok {
+			return ErrNoArea
+		}
+
+		names := make([]string, 0, len(areas))
+		for name := range areas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			for _, fallback := range areas[name].Fallback {
+				if fallback == areaName && name != areaName {
+					return fmt.Errorf("%w: %q is a fallback of %q", ErrBadArea, areaName, name)
+				}
+			}
+		}
+
+		delete(areas, areaName)
+		return nil
+	})
+}
+
+// SetNode adds n to an area or replaces the node with the same address.
+func SetNode(platName string, areaName string, n *Node) error {
+	if err := n.validate(); err != nil {
+		return err
+	}
+	if err := n.validateHc(); err != nil {
+		return err
+	}
+	ip := net.ParseIP(n.Addr)
+
+	return UpdateAreas(platName, func(areas Areas) error {
+		area, ok := areas[areaName]
+		if !ok {
+			return ErrNoArea
+		}
+
+		nodes := &area.IPV6nodes
+		if ip.To4() != nil {
+			nodes = &area.IPV4nodes
+		}
+
+		for i := range *nodes {
+			if (*nodes)[i].Addr == n.Addr {
+				(*nodes)[i] = n
+				return nil
+			}
+		}
+		*nodes = append(*nodes, n)
+
+		return nil
+	})
+}
+
+func DeleteNode(platName string, areaName string, addr string) error {
+	return UpdateAreas(platName, func(areas Areas) error {
+		area, ok := areas[areaName]
+		if !ok {
+			return ErrNoArea
+		}
+
+		for _, nodes := range []*[]*Node{&area.IPV4nodes, &area.IPV6nodes} {
+			for i := range *nodes {
+				if (*nodes)[i].Addr == addr {
+					*nodes = append((*nodes)[:i:i], (*nodes)[i+1:]...)
+					return nil
+				}
+			}
+		}
+
+		return ErrNoNode
+	})
+}
+
+// SetNodeState sets the state of the node with address addr in every
+// area of platName.
+func SetNodeState(platName string, addr string, state string) error {
+	if !validState(state) {
+		return ErrBadState
+	}
+
+	return UpdateAreas(platName, func(areas Areas) error {
+		found := false
+
+		for _, area := range areas {
+			for _, nodes := range [][]*Node{area.IPV4nodes, area.IPV6nodes} {
+				for _, n := range nodes {
+					if n.Addr == addr {
+						n.State = state
+						found = true
+					}
+				}
+			}
+		}
+
+		if !found {
+			return ErrNoNode
+		}
+
+		return nil
+	})
+}
+
+// clone deep copies areas, the query path keeps reading the original.
+func (areas Areas) clone() (Areas, error) {
+	js, err := json.Marshal(areas)
+	if err != nil {
+		return nil, err
+	}
+
+	c := make(Areas)
+	if err = json.Unmarshal(js, &c); err != nil {
+		return nil, err
+	}
+	c.prepare()
+
+	return c, nil
+}
+
+// writeAreas replaces fileName atomically by writing a temporary file
+// next to it and renaming it.
+func writeAreas(fileName string, areas Areas) error {
+	js, err := json.MarshalIndent(areas, "", "    ")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	tmp, err := ioutil.TempFile(filepath.Dir(fileName), "."+filepath.Base(fileName))
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(js); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if fi, serr := os.Stat(fileName); serr == nil {
+			err = os.Chmod(tmp.Name(), fi.Mode())
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fileName)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+func (n *Node) validate() error {
+	if net.ParseIP(n.Addr) == nil {
+		return ErrBadIP
+	}
+
+	if !validState(n.State) {
+		return ErrBadState
+	}
+
+	for _, c := range n.Capacity {
+		if c <= 0 {
+			return ErrBadCap
+		}
+	}
+
+	return nil
+}
+
+// validateHc rejects a health check that can't be set up. Node files
+// only log it, a node changed through the API would be served unchecked.
+func (n *Node) validateHc() error {
+	if n.Hc == nil {
+		return nil
+	}
+
+	if err := n.Hc.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", ErrBadHc, err)
+	}
+
+	return nil
+}
+
+func validState(state string) bool {
+	switch state {
+	case "", StateActive, StateDrain, StateMaintenance:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,151 @@
+package zone
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rench1988/gslb-dns/hc"
+)
+
+func TestSetValidates(t *testing.T) {
+	nodes := writeTestFile(t, t.TempDir(), "nodes.json", `{"@": {"A": [{"ip": "1.1.1.1", "weight": 1}]}}`)
+
+	err := UpdatePlats(func(ps Plats) error { return ps.AddPlatInfo("validate.test", nodes) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		UpdatePlats(func(ps Plats) error {
+			ps.DeletePlatInfo("validate.test")
+			return nil
+		})
+	})
+
+	tests := []struct {
+		name string
+		err  error
+		set  func() error
+	}{
+		{"bad address", ErrBadIP, func() error {
+			return SetNode("validate.test", "@", &Node{Addr: "1.1.1", Weight: 1})
+		}},
+		{"unknown check type", ErrBadHc, func() error {
+			return SetNode("validate.test", "@", &Node{Addr: "1.1.1.2", Weight: 1, Hc: &hc.Config{Type: "bogus"}})
+		}},
+		{"check in an area", ErrBadHc, func() error {
+			return SetArea("validate.test", "x", &Area{IPV4nodes: []*Node{{Addr: "1.1.1.2", Hc: &hc.Config{Type: "tcp"}}}})
+		}},
+		{"unknown policy", ErrBadArea, func() error {
+			return SetArea("validate.test", "x", &Area{Policy: "fail-sometimes"})
+		}},
+		{"unknown fallback", ErrBadArea, func() error {
+			return SetArea("validate.test", "x", &Area{Fallback: []string{"y"}})
+		}},
+		{"fallback to itself", ErrBadArea, func() error {
+			return SetArea("validate.test", "x", &Area{Fallback: []string{"x"}})
+		}},
+		{"fallback-cname without a CNAME", ErrBadArea, func() error {
+			return SetArea("validate.test", "x", &Area{Policy: PolicyFallbackCname})
+		}},
+		{"fallback-cname", nil, func() error {
+			return SetArea("validate.test", "x", &Area{Policy: PolicyFallbackCname, FallbackCname: "www.example.net"})
+		}},
+		{"good area", nil, func() error {
+			return SetArea("validate.test", "x", &Area{Policy: PolicyFailOpen, Fallback: []string{"@"}})
+		}},
+	}
+
+	for _, tt := range tests {
+		if err := tt.set(); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestSetPlatOptions(t *testing.T) {
+	ps := Plats{"p": &Plat{}}
+
+	good := PlatOptions{Selection: SelectionConsistentHash, SlowStart: SlowStart{Window: 60, Start: 0.5}}
+	if err := ps.SetPlatOptions("p", good); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []PlatOptions{
+		{Policy: "fail-sometimes"},
+		{Policy: PolicyFallbackCname},
+		{Selection: "consistent_hash"},
+		{SlowStart: SlowStart{Window: 60, Start: 2}},
+		{SlowStart: SlowStart{Window: 60, Mode: "log"}},
+		{SlowStart: SlowStart{Window: -1}},
+	} {
+		if err := ps.SetPlatOptions("p", bad); err == nil {
+			t.Errorf("%+v accepted", bad)
+		}
+		if ps["p"].Options != good {
+			t.Errorf("%+v replaced the previous options", bad)
+		}
+	}
+}
+
+func TestPlatCheckPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	bad := writeTestFile(t, dir, "bad.json", `{"@": {"A": [{"ip": "1.1.1.1", "weight": 1}], "policy": "fail-sometimes"}}`)
+	if err := (Plats{}).AddPlatInfo("p", bad); !errors.Is(err, ErrBadArea) {
+		t.Errorf("unknown policy: got %v, want %v", err, ErrBadArea)
+	}
+
+	nodes := writeTestFile(t, dir, "nodes.json", `{
+	"@": {"A": [{"ip": "1.1.1.1", "weight": 1}], "policy": "fallback-cname"},
+	"x": {"A": [{"ip": "1.1.1.2", "weight": 1}], "policy": "fallback-cname", "fallback_cname": "x.example.net"}
+}`)
+	ps := Plats{}
+	if err := ps.AddPlatInfo("p", nodes); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := ps["p"].Check()
+	if len(errs) != 1 || errs[0].Path != "@.fallback_cname" {
+		t.Errorf("got %v, want the CNAME of @ missing", errs)
+	}
+
+	// the platform's CNAME will do
+	if err := ps.SetPlatOptions("p", PlatOptions{FallbackCname: "example.net"}); err != nil {
+		t.Fatal(err)
+	}
+	if errs := ps["p"].Check(); len(errs) != 0 {
+		t.Errorf("got %v with the CNAME of the platform", errs)
+	}
+}
+
+func TestDeleteAreaInUse(t *testing.T) {
+	nodes := writeTestFile(t, t.TempDir(), "nodes.json", `{
+	"@": {"A": [{"ip": "1.1.1.1", "weight": 1}]},
+	"x": {"A": [{"ip": "1.1.1.2", "weight": 1}], "fallback": ["@"]}
+}`)
+
+	err := UpdatePlats(func(ps Plats) error { return ps.AddPlatInfo("delete.test", nodes) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		UpdatePlats(func(ps Plats) error {
+			ps.DeletePlatInfo("delete.test")
+			return nil
+		})
+	})
+
+	if err := DeleteArea("delete.test", "@"); !errors.Is(err, ErrBadArea) {
+		t.Errorf("deleting a fallback: got %v, want %v", err, ErrBadArea)
+	}
+	if CurrentPlats()["delete.test"].Areas["@"] == nil {
+		t.Error("fallback area deleted")
+	}
+
+	if err := DeleteArea("delete.test", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteArea("delete.test", "@"); err != nil {
+		t.Errorf("deleting an unused area: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package zone
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// effectiveWeight is the weight of n for new traffic at now: the one of
+// the schedules, lowered by its load and while it ramps up.
+func (n *Node) effectiveWeight(area Schedule, s SlowStart, loads Loads, now time.Time) float64 {
+	w := n.scheduledWeight(area, now)
+	if w <= 0 {
+		return 0
+	}
+
+	return w * n.loadFactor(loads) * n.rampFactor(s, now)
+}
+
+// effectiveWeights are the weights of the nodes of p for new traffic,
+// nil when they're the configured ones and the alias table holds.
+func (p *picker) effectiveWeights(q Query) []float64 {
+	var loads Loads
+	if p.loaded {
+		loads = CurrentLoads()
+	}
+
+	if loads == nil && !p.scheduled && q.slowStart.Window <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	changed := false
+
+	weights := make([]float64, len(p.nodes))
+	for i, n := range p.nodes {
+		weights[i] = n.effectiveWeight(p.schedule, q.slowStart, loads, now)
+		if weights[i] != math.Max(float64(n.Weight), 0) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return weights
+}
+
+// NodeWeight is the weight a node gets right now.
+type NodeWeight struct {
+	Platform  string  `json:"platform"`
+	Area      string  `json:"area"`
+	Addr      string  `json:"ip"`
+	State     string  `json:"state,omitempty"`
+	Healthy   bool    `json:"healthy"`
+	Weight    int     `json:"weight"`
+	Scheduled float64 `json:"scheduled_weight"`
+	Effective float64 `json:"effective_weight"`
+	Ramp      float64 `json:"ramp"` // the part of the weight slow start lets through
+	Load      float64 `json:"load"` // the part of the weight the load leaves
+}
+
+// NodeWeights returns the current weights of the nodes of platName by
+// area, A before AAAA.
+func (ps Plats) NodeWeights(platName string) ([]NodeWeight, error) {
+	p := ps[platName]
+	if p == nil {
+		return nil, ErrNoPlat
+	}
+
+	names := make([]string, 0, len(p.Areas))
+	for name := range p.Areas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	loads := CurrentLoads()
+	now := time.Now()
+	s := p.Options.SlowStart
+
+	res := []NodeWeight{}
+	for _, name := range names {
+		area := p.Areas[name]
+		for _, nodes := range [][]*Node{area.IPV4nodes, area.IPV6nodes} {
+			for _, n := range nodes {
+				res = append(res, NodeWeight{
+					Platform:  platName,
+					Area:      name,
+					Addr:      n.Addr,
+					State:     n.State,
+					Healthy:   n.healthy(),
+					Weight:    n.Weight,
+					Scheduled: n.scheduledWeight(area.Schedule, now),
+					Effective: n.effectiveWeight(area.Schedule, s, loads, now),
+					Ramp:      n.rampFactor(s, now),
+					Load:      n.loadFactor(loads),
+				})
+			}
+		}
+	}
+
+	return res, nil
+}
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/rench1988/gslb-dns/log"
 
@@ -20,9 +21,11 @@ import (
 var qLogger qlog.QLogger
 
 var (
-	zonce sync.Once
+	// the zones being served, UpdateZones swaps in the next generation
+	zoneGen atomic.Pointer[Zones]
 
-	zs Zones
+	// writers build the next generation one at a time
+	zMutex sync.Mutex
 )
 
 type ZoneOptions struct {
@@ -43,52 +46,121 @@ type Zone struct {
 	sync.RWMutex
 }
 
+// Zones are keyed by origin.
 type Zones map[string]*Zone
 
 type qTypes []uint16
 
-func NewZones() Zones {
-	zonce.Do(func() {
-		zs = make(Zones)
-	})
+// CurrentZones returns the zones being served. They must not be
+// changed, use UpdateZones.
+func CurrentZones() Zones {
+	if p := zoneGen.Load(); p != nil {
+		return *p
+	}
 
-	return zs
+	return nil
 }
 
-func (zs Zones) SetupGslbZone() {
+// UpdateZones applies fn to a copy of the current zones and serves the
+// result unless fn fails.
+func UpdateZones(fn func(Zones) error) error {
+	zMutex.Lock()
+	defer zMutex.Unlock()
+
+	next := make(Zones)
+	for k, v := range CurrentZones() {
+		next[k] = v
+	}
+
+	if err := fn(next); err != nil {
+		return err
+	}
+
+	zoneGen.Store(&next)
+
+	return nil
+}
+
+func SetupGslbZone() {
 	zoneName := "gslb-dns"
 	Zone := newZone(zoneName)
 	label := new(Label)
 	label.Records = make(map[uint16]Records)
 	label.Weight = make(map[uint16]int)
 	Zone.Labels[""] = label
-	setupSOA(Zone)
-	zs.AddDNSHandler(zoneName, Zone)
+	if err := setupSOA(Zone); err != nil {
+		log.Println("SOA Error", err)
+	}
+
+	UpdateZones(func(zs Zones) error {
+		zs[zoneName] = Zone
+		return nil
+	})
 }
 
-func (zs Zones) SetupRootZone() {
+// SetupRootZone answers every query from the current zones, names
+// outside all of them are refused.
+func SetupRootZone() {
 	dns.HandleFunc(".", func(w dns.ResponseWriter, r *dns.Msg) {
+		if len(r.Question) > 0 {
+			if z := CurrentZones().match(r.Question[0].Name); z != nil {
+				serve(w, r, z)
+				return
+			}
+		}
+
 		m := new(dns.Msg)
 		m.SetRcode(r, dns.RcodeRefused)
 		w.WriteMsg(m)
 	})
 }
 
-func (zs Zones) AddDNSHandler(zoneName string, z *Zone) {
-	zs[zoneName] = z
-	dns.HandleFunc(zoneName, func(w dns.ResponseWriter, r *dns.Msg) {
-		serve(w, r, z)
-	})
+// match returns the zone with the longest origin qname is in.
+func (zs Zones) match(qname string) *Zone {
+	name := strings.TrimSuffix(strings.ToLower(qname), ".")
+
+	for {
+		if z, ok := zs[name]; ok {
+			return z
+		}
+
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			return nil
+		}
+		name = name[i+1:]
+	}
 }
 
-func (zs Zones) AddZoneInfo(platName string, zoneFile string) (z *Zone, err error) {
+// AddZoneInfo reads a domain file of platName. The zone origin is the
+// "origin" from the file, or origin when the file has none.
+func (zs Zones) AddZoneInfo(platName string, origin string, zoneFile string) (z *Zone, err error) {
 	fh, err := os.Open(zoneFile)
 	if err != nil {
 		log.Printf("Could not read '%s': %s", zoneFile, err)
 		return nil, err
 	}
+	defer fh.Close()
+
+	var objmap map[string]interface{}
+	decoder := json.NewDecoder(fh)
+	if err = decoder.Decode(&objmap); err != nil {
+		return nil, err
+	}
+
+	var errs ParseErrors
+
+	if v, ok := objmap["origin"]; ok {
+		if o, err := util.ValueToString(v); err != nil {
+			errs.add("origin", "%s", err)
+		} else {
+			origin = o
+		}
+	}
+	origin = strings.TrimSuffix(strings.ToLower(origin), ".")
 
-	zone := newZone(platName)
+	zone := newZone(origin)
+	zone.Platform = platName
 
 	fi, err := fh.Stat()
 	if err != nil {
@@ -97,35 +169,52 @@ func (zs Zones) AddZoneInfo(platName string, zoneFile string) (z *Zone, err erro
 		zone.Options.Serial = int(fi.ModTime().Unix())
 	}
 
-	var objmap map[string]interface{}
-	decoder := json.NewDecoder(fh)
-	if err = decoder.Decode(&objmap); err != nil {
-		return nil, err
-	}
-
 	var data map[string]interface{}
 
 	for k, v := range objmap {
 		switch k {
-		case "ttl":
-			zone.Options.Ttl = util.ValueToInt(v)
-		case "serial":
-			zone.Options.Serial = util.ValueToInt(v)
+		case "ttl", "serial", "max_hosts":
+			i, err := util.ValueToInt(v)
+			if err != nil {
+				errs.add(k, "%s", err)
+				continue
+			}
+			switch k {
+			case "ttl":
+				zone.Options.Ttl = i
+			case "serial":
+				zone.Options.Serial = i
+			case "max_hosts":
+				zone.Options.MaxHosts = i
+			}
 		case "contact":
-			zone.Options.Contact = v.(string)
-		case "max_hosts":
-			zone.Options.MaxHosts = util.ValueToInt(v)
+			if c, ok := v.(string); ok {
+				zone.Options.Contact = c
+			} else {
+				errs.add(k, "expected a string")
+			}
 		case "data":
-			data = v.(map[string]interface{})
+			d, ok := v.(map[string]interface{})
+			if !ok {
+				errs.add(k, "expected an object")
+				continue
+			}
+			data = d
 		}
 	}
 
-	setupZoneData(data, zone)
+	errs = append(errs, setupZoneData(data, zone)...)
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
 
 	return zone, nil
 }
 
-func setupZoneData(data map[string]interface{}, Zone *Zone) {
+// setupZoneData adds the labels in data to Zone. Bad records are skipped
+// and returned as errors.
+func setupZoneData(data map[string]interface{}, Zone *Zone) ParseErrors {
 	recordTypes := map[string]uint16{
 		"a":     dns.TypeA,
 		"aaaa":  dns.TypeAAAA,
@@ -139,18 +228,51 @@ func setupZoneData(data map[string]interface{}, Zone *Zone) {
 		"ptr":   dns.TypePTR,
 	}
 
-	for dk, dvInter := range data {
-		dv := dvInter.(map[string]interface{})
+	var errs ParseErrors
+
+	for _, dk := range sortedKeys(data) {
+		lpath := labelPath(dk)
+
+		dv, ok := data[dk].(map[string]interface{})
+		if !ok {
+			errs.add(lpath, "expected an object")
+			continue
+		}
 
 		label := Zone.AddLabel(dk)
 
-		for rType, rdata := range dv {
+		for _, rType := range sortedKeys(dv) {
+			rdata := dv[rType]
+			rpath := lpath + "." + rType
+
 			switch rType {
-			case "max_hosts":
-				label.MaxHosts = util.ValueToInt(rdata)
+			case "max_hosts", "ttl":
+				i, err := util.ValueToInt(rdata)
+				if err != nil {
+					errs.add(rpath, "%s", err)
+				} else if rType == "ttl" {
+					label.Ttl = i
+				} else {
+					label.MaxHosts = i
+				}
 				continue
-			case "ttl":
-				label.Ttl = util.ValueToInt(rdata)
+			case "selection":
+				if mode, ok := rdata.(string); !ok || !ValidSelection(mode) {
+					errs.add(rpath, "unknown selection %v", rdata)
+				} else {
+					label.Selection = mode
+				}
+				continue
+			case "tiers":
+				label.Tiers = parseTiers(&errs, rpath, rdata, label.Platform)
+				continue
+			case "pool":
+				// draw the nodes from another platform
+				if pool, err := util.ValueToString(rdata); err != nil {
+					errs.add(rpath, "%s", err)
+				} else {
+					label.Platform = pool
+				}
 				continue
 			}
 
@@ -164,31 +286,43 @@ func setupZoneData(data map[string]interface{}, Zone *Zone) {
 				continue
 			}
 
-			records := make(map[string][]interface{})
+			var records []interface{}
+			single := false
 
 			switch rdata.(type) {
 			case map[string]interface{}:
 				// Handle NS map syntax, map[ns2.example.net:<nil> ns1.example.net:<nil>]
-				tmp := make([]interface{}, 0)
-				for rdataK, rdataV := range rdata.(map[string]interface{}) {
+				for _, rdataK := range sortedKeys(rdata.(map[string]interface{})) {
+					rdataV := rdata.(map[string]interface{})[rdataK]
 					if rdataV == nil {
 						rdataV = ""
 					}
-					tmp = append(tmp, []string{rdataK, rdataV.(string)})
+					v, ok := rdataV.(string)
+					if !ok {
+						errs.add(rpath+"."+rdataK, "expected a string")
+						continue
+					}
+					records = append(records, []string{rdataK, v})
 				}
-				records[rType] = tmp
 			case string:
 				// CNAME and alias
-				tmp := make([]interface{}, 1)
-				tmp[0] = rdata.(string)
-				records[rType] = tmp
+				records = []interface{}{rdata}
+				single = true
+			case []interface{}:
+				records = rdata.([]interface{})
 			default:
-				records[rType] = rdata.([]interface{})
+				errs.add(rpath, "unsupported value %v", rdata)
+				continue
 			}
 
-			label.Records[dnsType] = make(Records, len(records[rType]))
+			label.Records[dnsType] = make(Records, 0, len(records))
+
+			for i, rec := range records {
+				path := rpath
+				if !single {
+					path = fmt.Sprintf("%s[%d]", rpath, i)
+				}
 
-			for i := 0; i < len(records[rType]); i++ {
 				record := new(Record)
 
 				var h dns.RR_Header
@@ -208,82 +342,81 @@ func setupZoneData(data map[string]interface{}, Zone *Zone) {
 				switch dnsType {
 				case dns.TypeA, dns.TypeAAAA, dns.TypePTR:
 
-					str, weight := getWeight(records[rType][i].([]interface{}))
-					ip := str
+					ip, weight, err := getWeight(rec)
+					if err != nil {
+						errs.add(path, "%s", err)
+						continue
+					}
 					record.Weight = weight
 
 					switch dnsType {
 					case dns.TypePTR:
 						record.RR = &dns.PTR{Hdr: h, Ptr: ip}
-						break
 					case dns.TypeA:
-						if x := net.ParseIP(ip); x != nil {
-							record.RR = &dns.A{Hdr: h, A: x}
-							break
+						x := net.ParseIP(ip)
+						if x == nil || x.To4() == nil {
+							errs.add(path, "invalid IPv4 %q", ip)
+							continue
 						}
-						panic(fmt.Errorf("Bad A record %s for %s", ip, dk))
+						record.RR = &dns.A{Hdr: h, A: x}
 					case dns.TypeAAAA:
-						if x := net.ParseIP(ip); x != nil {
-							record.RR = &dns.AAAA{Hdr: h, AAAA: x}
-							break
+						x := net.ParseIP(ip)
+						if x == nil || !strings.Contains(ip, ":") {
+							errs.add(path, "invalid IPv6 %q", ip)
+							continue
 						}
-						panic(fmt.Errorf("Bad AAAA record %s for %s", ip, dk))
+						record.RR = &dns.AAAA{Hdr: h, AAAA: x}
 					}
 
 				case dns.TypeMX:
-					rec := records[rType][i].(map[string]interface{})
-					pref := uint16(0)
-					mx := rec["mx"].(string)
-					if !strings.HasSuffix(mx, ".") {
-						mx = mx + "."
+					rec, ok := rec.(map[string]interface{})
+					if !ok {
+						errs.add(path, "expected an object")
+						continue
 					}
-					if rec["weight"] != nil {
-						record.Weight = util.ValueToInt(rec["weight"])
+					mx, ok := rec["mx"].(string)
+					if !ok {
+						errs.add(path+".mx", "expected a string")
+						continue
 					}
-					if rec["preference"] != nil {
-						pref = uint16(util.ValueToInt(rec["preference"]))
+					if !strings.HasSuffix(mx, ".") {
+						mx = mx + "."
 					}
+					record.Weight = intField(&errs, path, rec, "weight")
+					pref := uint16Field(&errs, path, rec, "preference")
 					record.RR = &dns.MX{
 						Hdr:        h,
 						Mx:         mx,
 						Preference: pref}
 
 				case dns.TypeSRV:
-					rec := records[rType][i].(map[string]interface{})
-					priority := uint16(0)
-					srvWeight := uint16(0)
-					port := uint16(0)
-					target := rec["target"].(string)
+					rec, ok := rec.(map[string]interface{})
+					if !ok {
+						errs.add(path, "expected an object")
+						continue
+					}
+					target, ok := rec["target"].(string)
+					if !ok {
+						errs.add(path+".target", "expected a string")
+						continue
+					}
 
 					if !dns.IsFqdn(target) {
 						target = target + "." + Zone.Origin
 					}
 
-					if rec["srv_weight"] != nil {
-						srvWeight = uint16(util.ValueToInt(rec["srv_weight"]))
-					}
-					if rec["port"] != nil {
-						port = uint16(util.ValueToInt(rec["port"]))
-					}
-					if rec["priority"] != nil {
-						priority = uint16(util.ValueToInt(rec["priority"]))
-					}
 					record.RR = &dns.SRV{
 						Hdr:      h,
-						Priority: priority,
-						Weight:   srvWeight,
-						Port:     port,
+						Priority: uint16Field(&errs, path, rec, "priority"),
+						Weight:   uint16Field(&errs, path, rec, "srv_weight"),
+						Port:     uint16Field(&errs, path, rec, "port"),
 						Target:   target}
 
 				case dns.TypeCNAME:
-					rec := records[rType][i]
-					var target string
-					var weight int
-					switch rec.(type) {
-					case string:
-						target = rec.(string)
-					case []interface{}:
-						target, weight = getWeight(rec.([]interface{}))
+					target, weight, err := getWeight(rec)
+					if err != nil {
+						errs.add(path, "%s", err)
+						continue
 					}
 					if !dns.IsFqdn(target) {
 						target = target + "." + Zone.Origin
@@ -292,12 +425,15 @@ func setupZoneData(data map[string]interface{}, Zone *Zone) {
 					record.RR = &dns.CNAME{Hdr: h, Target: dns.Fqdn(target)}
 
 				case dns.TypeMF:
-					rec := records[rType][i]
 					// MF records (how we store aliases) are not FQDNs
-					record.RR = &dns.MF{Hdr: h, Mf: rec.(string)}
+					mf, ok := rec.(string)
+					if !ok {
+						errs.add(path, "expected a string")
+						continue
+					}
+					record.RR = &dns.MF{Hdr: h, Mf: mf}
 
 				case dns.TypeNS:
-					rec := records[rType][i]
 					if h.Ttl < 86400 {
 						h.Ttl = 86400
 					}
@@ -314,16 +450,17 @@ func setupZoneData(data map[string]interface{}, Zone *Zone) {
 							log.Println("NS records with names syntax not supported")
 						}
 					default:
-						log.Printf("Data: %T %#v\n", rec, rec)
-						panic("Unrecognized NS format/syntax")
+						errs.add(path, "unrecognized NS format %v", rec)
+						continue
 					}
 
 					rr := &dns.NS{Hdr: h, Ns: dns.Fqdn(ns)}
 
 					record.RR = rr
 
-				case dns.TypeTXT:
-					rec := records[rType][i]
+				case dns.TypeTXT, dns.TypeSPF:
+					// Initial SPF support added here, cribbed from the TypeTXT
+					// case definition - SPF records should be handled identically
 
 					var txt string
 
@@ -334,60 +471,34 @@ func setupZoneData(data map[string]interface{}, Zone *Zone) {
 
 						recmap := rec.(map[string]interface{})
 
-						if weight, ok := recmap["weight"]; ok {
-							record.Weight = util.ValueToInt(weight)
+						record.Weight = intField(&errs, path, recmap, "weight")
+						if t, ok := recmap[rType]; ok {
+							if txt, ok = t.(string); !ok {
+								errs.add(path+"."+rType, "expected a string")
+								continue
+							}
 						}
-						if t, ok := recmap["txt"]; ok {
-							txt = t.(string)
-						}
-					}
-					if len(txt) > 0 {
-						rr := &dns.TXT{Hdr: h, Txt: []string{txt}}
-						record.RR = rr
-					} else {
-						log.Printf("Zero length txt record for '%s' in '%s'\n", label.Label, Zone.Origin)
+					default:
+						errs.add(path, "unsupported value %v", rec)
 						continue
 					}
-					// Initial SPF support added here, cribbed from the TypeTXT case definition - SPF records should be handled identically
-
-				case dns.TypeSPF:
-					rec := records[rType][i]
-
-					var spf string
-
-					switch rec.(type) {
-					case string:
-						spf = rec.(string)
-					case map[string]interface{}:
-
-						recmap := rec.(map[string]interface{})
-
-						if weight, ok := recmap["weight"]; ok {
-							record.Weight = util.ValueToInt(weight)
-						}
-						if t, ok := recmap["spf"]; ok {
-							spf = t.(string)
-						}
+					if len(txt) == 0 {
+						log.Printf("Zero length %s record for '%s' in '%s'\n", rType, label.Label, Zone.Origin)
+						continue
 					}
-					if len(spf) > 0 {
-						rr := &dns.SPF{Hdr: h, Txt: []string{spf}}
-						record.RR = rr
+					if dnsType == dns.TypeSPF {
+						record.RR = &dns.SPF{Hdr: h, Txt: []string{txt}}
 					} else {
-						log.Printf("Zero length SPF record for '%s' in '%s'\n", label.Label, Zone.Origin)
-						continue
+						record.RR = &dns.TXT{Hdr: h, Txt: []string{txt}}
 					}
-
-				default:
-					log.Println("type:", rType)
-					panic("Don't know how to handle this type")
-				}
-
-				if record.RR == nil {
-					panic("record.RR is nil")
 				}
 
 				label.Weight[dnsType] += record.Weight
-				label.Records[dnsType][i] = *record
+				label.Records[dnsType] = append(label.Records[dnsType], *record)
+			}
+			if len(label.Records[dnsType]) == 0 {
+				delete(label.Records, dnsType)
+				continue
 			}
 			if label.Weight[dnsType] > 0 {
 				sort.Sort(RecordsByWeight{label.Records[dnsType]})
@@ -414,9 +525,16 @@ func setupZoneData(data map[string]interface{}, Zone *Zone) {
 				}
 			}
 		}
+		if label := Zone.Labels[k]; label.Selection == SelectionConsistentHash {
+			label.prepareRings()
+		}
 	}
 
-	setupSOA(Zone)
+	if err := setupSOA(Zone); err != nil {
+		errs.add("contact", "%s", err)
+	}
+
+	return errs
 }
 
 func newZone(name string) *Zone {
@@ -434,7 +552,7 @@ func newZone(name string) *Zone {
 	return zone
 }
 
-func setupSOA(Zone *Zone) {
+func setupSOA(Zone *Zone) error {
 	label := Zone.Labels[""]
 
 	primaryNs := "ns"
@@ -467,38 +585,132 @@ func setupSOA(Zone *Zone) {
 	rr, err := dns.NewRR(s)
 
 	if err != nil {
-		log.Println("SOA Error", err)
-		panic("Could not setup SOA")
+		return fmt.Errorf("could not setup SOA: %s", err)
 	}
 
 	record := Record{RR: rr}
 
 	label.Records[dns.TypeSOA] = make([]Record, 1)
 	label.Records[dns.TypeSOA][0] = record
+
+	return nil
 }
 
 func SetupQLog(logger qlog.QLogger) {
 	qLogger = logger
 }
 
-func getWeight(rec []interface{}) (string, int) {
-	str := rec[0].(string)
+// getWeight splits a "name" or ["name", weight] record.
+func getWeight(rec interface{}) (string, int, error) {
+	switch rec.(type) {
+	case string:
+		return rec.(string), 0, nil
+	case []interface{}:
+	default:
+		return "", 0, fmt.Errorf("unsupported value %v", rec)
+	}
+
+	recl := rec.([]interface{})
+	if len(recl) == 0 {
+		return "", 0, fmt.Errorf("empty record")
+	}
+
+	str, ok := recl[0].(string)
+	if !ok {
+		return "", 0, fmt.Errorf("expected a string, got %v", recl[0])
+	}
+
 	var weight int
 
-	if len(rec) > 1 {
-		switch rec[1].(type) {
-		case string:
-			var err error
-			weight, err = strconv.Atoi(rec[1].(string))
-			if err != nil {
-				panic("Error converting weight to integer")
+	if len(recl) > 1 {
+		var err error
+		if weight, err = util.ValueToInt(recl[1]); err != nil {
+			return "", 0, fmt.Errorf("weight: %s", err)
+		}
+	}
+
+	return str, weight, nil
+}
+
+// parseTiers reads a list of {"pool": "name", "min_healthy": 2} tiers,
+// min_healthy can be a percentage of the weight like "50%".
+func parseTiers(errs *ParseErrors, path string, v interface{}, pool string) []Tier {
+	list, ok := v.([]interface{})
+	if !ok {
+		errs.add(path, "expected a list")
+		return nil
+	}
+
+	tiers := make([]Tier, 0, len(list))
+
+	for i, t := range list {
+		tpath := fmt.Sprintf("%s[%d]", path, i)
+
+		rec, ok := t.(map[string]interface{})
+		if !ok {
+			errs.add(tpath, "expected an object")
+			continue
+		}
+
+		tier := Tier{Pool: pool}
+
+		if p, ok := rec["pool"]; ok {
+			if tier.Pool, ok = p.(string); !ok {
+				errs.add(tpath+".pool", "expected a string")
+				continue
+			}
+		}
+
+		if s, ok := rec["min_healthy"].(string); ok && strings.HasSuffix(s, "%") {
+			pct, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+			if err != nil || pct < 0 || pct > 100 {
+				errs.add(tpath+".min_healthy", "invalid percentage %q", s)
+				continue
 			}
-		case float64:
-			weight = int(rec[1].(float64))
+			tier.MinPercent = pct
+		} else {
+			tier.MinHealthy = intField(errs, tpath, rec, "min_healthy")
 		}
+
+		tiers = append(tiers, tier)
+	}
+
+	return tiers
+}
+
+// intField returns the integer rec[key], zero if it's missing or bad.
+func intField(errs *ParseErrors, path string, rec map[string]interface{}, key string) int {
+	v, ok := rec[key]
+	if !ok || v == nil {
+		return 0
+	}
+
+	i, err := util.ValueToInt(v)
+	if err != nil {
+		errs.add(path+"."+key, "%s", err)
+	}
+
+	return i
+}
+
+func uint16Field(errs *ParseErrors, path string, rec map[string]interface{}, key string) uint16 {
+	i := intField(errs, path, rec, key)
+	if i < 0 || i > 65535 {
+		errs.add(path+"."+key, "%d out of range", i)
+		return 0
+	}
+
+	return uint16(i)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
-	return str, weight
+	return keys
 }
 
 func (z *Zone) AddLabel(k string) *Label {
@@ -516,7 +728,14 @@ func (z *Zone) AddLabel(k string) *Label {
 	return label
 }
 
+// an alias chain longer than this is taken for a loop
+const maxAliasDepth = 8
+
 func (z *Zone) findLabels(s string, targets []string, qts qTypes) (*Label, uint16) {
+	return z.findLabelsDepth(s, targets, qts, 0)
+}
+
+func (z *Zone) findLabelsDepth(s string, targets []string, qts qTypes, depth int) (*Label, uint16) {
 	for _, target := range targets {
 		var name string
 
@@ -543,8 +762,11 @@ func (z *Zone) findLabels(s string, targets []string, qts qTypes) (*Label, uint1
 				case dns.TypeMF:
 					if label.Records[dns.TypeMF] != nil {
 						name = label.firstRR(dns.TypeMF).(*dns.MF).Mf
-						// TODO: need to avoid loops here somehow
-						return z.findLabels(name, targets, qts)
+						if depth >= maxAliasDepth {
+							log.Printf("Alias loop or chain too long at %s in %s\n", name, z.Origin)
+							return nil, 0
+						}
+						return z.findLabelsDepth(name, targets, qts, depth+1)
 					}
 				default:
 					// return the label if it has the right record